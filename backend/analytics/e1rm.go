@@ -0,0 +1,86 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// Formula is a one-rep max estimation formula
+type Formula string
+
+const (
+	Epley   Formula = "epley"
+	Brzycki Formula = "brzycki"
+
+	DefaultFormula = Epley
+)
+
+var ErrUnknownFormula = errors.New("unknown e1RM formula")
+
+// ParseFormula resolves a formula name, falling back to the default for an empty name
+func ParseFormula(name string) (Formula, error) {
+	switch Formula(strings.ToLower(name)) {
+	case "":
+		return DefaultFormula, nil
+	case Epley:
+		return Epley, nil
+	case Brzycki:
+		return Brzycki, nil
+	}
+	return "", ErrUnknownFormula
+}
+
+// EstimateOneRepMax estimates the heaviest single from a set of reps at weight.
+// A single is its own one-rep max; sets without reps or weight estimate 0.
+func EstimateOneRepMax(formula Formula, weight float64, reps int) float64 {
+	if reps < 1 || weight <= 0 {
+		return 0
+	}
+	if reps == 1 {
+		return weight
+	}
+
+	switch formula {
+	case Brzycki:
+		// the formula breaks down at 37 reps, where the denominator reaches zero
+		if reps >= 37 {
+			return 0
+		}
+		return weight * 36 / float64(37-reps)
+	default:
+		return weight * (1 + float64(reps)/30)
+	}
+}
+
+// rpeChart is the share of the one-rep max that can be lifted for a number of effective reps, the reps done plus the
+// reps left in reserve, in half rep steps from 1. It follows the RPE chart popularised by Reactive Training Systems.
+var rpeChart = []float64{
+	1.000, 0.978, 0.955, 0.939, 0.922, 0.907, 0.892, 0.878, 0.863, 0.850,
+	0.837, 0.824, 0.811, 0.799, 0.786, 0.774, 0.762, 0.751, 0.739, 0.723,
+	0.707, 0.694, 0.680, 0.667, 0.653, 0.640, 0.626, 0.613, 0.599, 0.586,
+	0.574,
+}
+
+// EstimateOneRepMaxRPE estimates the one-rep max from the RPE chart. It reports false when the chart does not cover
+// the set, which happens past 16 effective reps or for an RPE outside 6 to 10.
+func EstimateOneRepMaxRPE(weight float64, reps int, rpe float64) (float64, bool) {
+	if reps < 1 || weight <= 0 || rpe < 6 || rpe > 10 {
+		return 0, false
+	}
+	step := int(math.Round((float64(reps) + 10 - rpe - 1) * 2))
+	if step >= len(rpeChart) {
+		return 0, false
+	}
+	return weight / rpeChart[step], true
+}
+
+// OneRepMax estimates the one-rep max of the set, from the RPE chart when the set has an RPE and from the formula otherwise
+func (s SetEntry) OneRepMax(formula Formula) float64 {
+	if s.RPE != nil {
+		if e1rm, ok := EstimateOneRepMaxRPE(s.Weight, s.Reps, *s.RPE); ok {
+			return e1rm
+		}
+	}
+	return EstimateOneRepMax(formula, s.Weight, s.Reps)
+}
@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Bucket is the period progress is aggregated over
+type Bucket string
+
+const (
+	Day   Bucket = "day"
+	Week  Bucket = "week"
+	Month Bucket = "month"
+)
+
+var ErrUnknownBucket = errors.New("unknown bucket")
+
+// ParseBucket resolves a bucket name, falling back to days for an empty name
+func ParseBucket(name string) (Bucket, error) {
+	switch Bucket(name) {
+	case "", Day:
+		return Day, nil
+	case Week:
+		return Week, nil
+	case Month:
+		return Month, nil
+	}
+	return "", ErrUnknownBucket
+}
+
+// Start truncates t to the start of the bucket containing it, in t's location. Weeks start on Monday.
+func (b Bucket) Start(t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch b {
+	case Week:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case Month:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// ProgressPoint aggregates the sets of one exercise performed within a bucket
+type ProgressPoint struct {
+	Start        time.Time
+	Sessions     int // workouts the exercise was performed in
+	TopSetWeight float64
+	TotalVolume  float64
+	TotalReps    int
+	BestE1RM     float64
+
+	// for time and distance based exercises
+	TotalDurationSeconds int
+	TotalDistanceMeters  float64
+}
+
+// Progress buckets the sets of an exercise and aggregates each bucket, oldest first. Buckets without sets are left out.
+func Progress(formula Formula, bucket Bucket, sets []SetEntry) []ProgressPoint {
+	points := map[time.Time]*ProgressPoint{}
+	sessions := map[time.Time]map[uint]bool{}
+	for _, set := range sets {
+		start := bucket.Start(set.PerformedAt)
+		point, ok := points[start]
+		if !ok {
+			point = &ProgressPoint{Start: start}
+			points[start] = point
+			sessions[start] = map[uint]bool{}
+		}
+
+		sessions[start][set.WorkoutID] = true
+		point.Sessions = len(sessions[start])
+		point.TotalReps += set.Reps
+		point.TotalVolume += set.Weight * float64(set.Reps)
+		point.TotalDurationSeconds += set.DurationSeconds
+		point.TotalDistanceMeters += set.DistanceMeters
+		if set.Reps > 0 && set.Weight > point.TopSetWeight {
+			point.TopSetWeight = set.Weight
+		}
+		if e1rm := set.OneRepMax(formula); e1rm > point.BestE1RM {
+			point.BestE1RM = e1rm
+		}
+	}
+
+	series := make([]ProgressPoint, 0, len(points))
+	for _, point := range points {
+		series = append(series, *point)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Start.Before(series[j].Start)
+	})
+	return series
+}
@@ -0,0 +1,102 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+)
+
+type RecordType string
+
+const (
+	HeaviestWeight   RecordType = "heaviest_weight"
+	BestE1RM         RecordType = "best_e1rm"
+	MostRepsAtWeight RecordType = "most_reps_at_weight"
+	BestSetVolume    RecordType = "best_set_volume"
+)
+
+// SetEntry is a logged set of one exercise along with when its workout was performed
+type SetEntry struct {
+	SetID           uint
+	WorkoutID       uint
+	Weight          float64
+	Reps            int
+	RPE             *float64 // given directly or derived from the reps in reserve, nil when the set has neither
+	DurationSeconds int      // zero for exercises not measured by time
+	DistanceMeters  float64  // zero for exercises not measured by distance
+	PerformedAt     time.Time
+}
+
+// Record is a set that beat every earlier set of the exercise in one respect
+type Record struct {
+	Type       RecordType
+	Value      float64
+	SetID      uint
+	Weight     float64
+	Reps       int
+	AchievedAt time.Time
+}
+
+// Bests holds the best values seen so far for one exercise
+type Bests struct {
+	HeaviestWeight   float64
+	BestE1RM         float64
+	BestSetVolume    float64
+	MostRepsAtWeight map[float64]int
+}
+
+func NewBests() *Bests {
+	return &Bests{MostRepsAtWeight: map[float64]int{}}
+}
+
+// Apply records the set against the bests and returns every record it set. Only strict improvements count,
+// so repeating a best is not a new record.
+func (b *Bests) Apply(formula Formula, set SetEntry) []Record {
+	if set.Reps < 1 {
+		return nil
+	}
+
+	var records []Record
+	add := func(typ RecordType, value float64) {
+		records = append(records, Record{
+			Type:       typ,
+			Value:      value,
+			SetID:      set.SetID,
+			Weight:     set.Weight,
+			Reps:       set.Reps,
+			AchievedAt: set.PerformedAt,
+		})
+	}
+
+	if set.Weight > b.HeaviestWeight {
+		b.HeaviestWeight = set.Weight
+		add(HeaviestWeight, set.Weight)
+	}
+	if e1rm := set.OneRepMax(formula); e1rm > b.BestE1RM {
+		b.BestE1RM = e1rm
+		add(BestE1RM, e1rm)
+	}
+	if volume := set.Weight * float64(set.Reps); volume > b.BestSetVolume {
+		b.BestSetVolume = volume
+		add(BestSetVolume, volume)
+	}
+	if set.Reps > b.MostRepsAtWeight[set.Weight] {
+		b.MostRepsAtWeight[set.Weight] = set.Reps
+		add(MostRepsAtWeight, float64(set.Reps))
+	}
+	return records
+}
+
+// RecordHistory replays every set of an exercise in the order it was performed and returns each record as it was set
+func RecordHistory(formula Formula, sets []SetEntry) []Record {
+	sets = append([]SetEntry(nil), sets...)
+	sort.SliceStable(sets, func(i, j int) bool {
+		return sets[i].PerformedAt.Before(sets[j].PerformedAt)
+	})
+
+	bests := NewBests()
+	records := []Record{}
+	for _, set := range sets {
+		records = append(records, bests.Apply(formula, set)...)
+	}
+	return records
+}
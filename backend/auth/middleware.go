@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"workout/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserIDKey is the gin context key holding the authenticated user's ID
+const UserIDKey = "userID"
+
+// Users finds the user an access token was issued to
+type Users interface {
+	GetUserByID(id int) (*models.User, error)
+}
+
+// Middleware rejects requests without a valid bearer access token, or whose user has been deleted since the token
+// was issued
+func Middleware(tokens *TokenManager, users Users) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		tokenString, found := strings.CutPrefix(header, "Bearer ")
+		if !found || tokenString == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			return
+		}
+
+		userID, err := tokens.ParseToken(tokenString, AccessToken)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		_, err = users.GetUserByID(int(userID))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidToken.Error()})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(UserIDKey, userID)
+		c.Next()
+	}
+}
+
+// UserID returns the ID of the user the request was authenticated as
+func UserID(c *gin.Context) uint {
+	return c.GetUint(UserIDKey)
+}
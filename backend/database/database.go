@@ -0,0 +1,92 @@
+package database
+
+import (
+	"fmt"
+	"os"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+
+	// MemoryPath selects an in-memory SQLite database that lives as long as the connection pool
+	MemoryPath = ":memory:"
+)
+
+// Config selects the storage backend. Postgres uses the connection fields, SQLite only Path.
+type Config struct {
+	Driver   string
+	Host     string
+	User     string
+	Password string
+	Name     string
+	Port     string
+	SSLMode  string
+	Path     string
+}
+
+// ConfigFromEnv reads the database settings from the environment. The test configuration reads DB_DRIVER_TEST,
+// DB_NAME_TEST and DB_PATH_TEST instead and defaults to in-memory SQLite, so the tests need no database server.
+func ConfigFromEnv(test bool) Config {
+	suffix, defaultDriver, defaultPath := "", Postgres, "workout.db"
+	if test {
+		suffix, defaultDriver, defaultPath = "_TEST", SQLite, MemoryPath
+	}
+
+	return Config{
+		Driver:   getenv("DB_DRIVER"+suffix, defaultDriver),
+		Host:     os.Getenv("DB_HOST"),
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		Name:     os.Getenv("DB_NAME" + suffix),
+		Port:     os.Getenv("DB_PORT"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+		Path:     getenv("DB_PATH"+suffix, defaultPath),
+	}
+}
+
+// Open connects to the configured backend
+func Open(cfg Config) (*gorm.DB, error) {
+	switch cfg.Driver {
+	case Postgres:
+		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+			cfg.Host, cfg.User, cfg.Password, cfg.Name, cfg.Port, cfg.SSLMode)
+		return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	case SQLite:
+		return openSQLite(cfg.Path)
+	}
+	return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+}
+
+func openSQLite(path string) (*gorm.DB, error) {
+	memory := path == MemoryPath
+	if memory {
+		path = "file::memory:"
+	}
+	// foreign keys are off by default in SQLite and have to be enabled on every connection
+	db, err := gorm.Open(sqlite.Open(path+"?_foreign_keys=on&_busy_timeout=5000"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	if memory {
+		// every connection to :memory: opens its own empty database, so keep to a single one
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
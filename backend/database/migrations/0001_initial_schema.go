@@ -0,0 +1,101 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// the schema as AutoMigrate used to create it on boot. It is migrated rather than created so databases set up
+// before versioned migrations existed are adopted as they are.
+func init() {
+	type Set struct {
+		gorm.Model
+		WorkoutExerciseID uint
+		SetNumber         int `gorm:"not null"`
+		Reps              int
+		Weight            float64
+		Planned           bool
+	}
+	type WorkoutExercise struct {
+		gorm.Model
+		WorkoutID  uint `gorm:"not null"`
+		ExerciseID uint `gorm:"not null"`
+		Sets       []Set
+	}
+	type Workout struct {
+		gorm.Model
+		Name        string    `gorm:"not null"`
+		UserID      uint      `gorm:"index"`
+		PerformedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP;index"`
+		StartedAt   *time.Time
+		FinishedAt  *time.Time
+		Exercises   []WorkoutExercise
+	}
+	type User struct {
+		gorm.Model
+		Username     string `gorm:"uniqueIndex;not null"`
+		Name         string
+		PasswordHash string
+		Workouts     []Workout
+	}
+	type Exercise struct {
+		gorm.Model
+		Name string `gorm:"not null"`
+	}
+	type PersonalRecord struct {
+		gorm.Model
+		UserID     uint   `gorm:"not null;index:idx_personal_records_user_exercise"`
+		ExerciseID uint   `gorm:"not null;index:idx_personal_records_user_exercise"`
+		SetID      uint   `gorm:"not null"`
+		Type       string `gorm:"not null"`
+		Value      float64
+		Weight     float64
+		Reps       int
+		AchievedAt time.Time
+	}
+	type TemplateExercise struct {
+		gorm.Model
+		TemplateID   uint `gorm:"not null;index"`
+		ExerciseID   uint `gorm:"not null"`
+		Position     int  `gorm:"not null"`
+		TargetSets   int
+		TargetReps   int
+		TargetWeight float64
+	}
+	type WorkoutTemplate struct {
+		gorm.Model
+		Name      string             `gorm:"not null"`
+		UserID    uint               `gorm:"not null;index"`
+		Exercises []TemplateExercise `gorm:"foreignKey:TemplateID"`
+	}
+
+	register(Migration{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(
+				&User{},
+				&Exercise{},
+				&Workout{},
+				&WorkoutExercise{},
+				&Set{},
+				&PersonalRecord{},
+				&WorkoutTemplate{},
+				&TemplateExercise{},
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(
+				&TemplateExercise{},
+				&WorkoutTemplate{},
+				&PersonalRecord{},
+				&Set{},
+				&WorkoutExercise{},
+				&Workout{},
+				&Exercise{},
+				&User{},
+			)
+		},
+	})
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// sets get a type so warm-ups can be left out of the analytics, existing sets become working sets
+func init() {
+	type Set struct {
+		Type string `gorm:"not null;default:working"`
+	}
+
+	register(Migration{
+		Version: 2,
+		Name:    "set_types",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&Set{}, "Type")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&Set{}, "Type")
+		},
+	})
+}
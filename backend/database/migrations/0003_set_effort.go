@@ -0,0 +1,34 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// optional RPE, reps in reserve and tempo on sets
+func init() {
+	type Set struct {
+		RPE   *float64
+		RIR   *int
+		Tempo string
+	}
+	columns := []string{"RPE", "RIR", "Tempo"}
+
+	register(Migration{
+		Version: 3,
+		Name:    "set_effort",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range columns {
+				if err := tx.Migrator().AddColumn(&Set{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range columns {
+				if err := tx.Migrator().DropColumn(&Set{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// exercises declare how they are measured, so sets can log duration, distance, heart rate and calories
+func init() {
+	type Exercise struct {
+		Measurement string `gorm:"not null;default:reps_weight"`
+	}
+	type Set struct {
+		DurationSeconds *int
+		DistanceMeters  *float64
+		HeartRate       *int
+		Calories        *int
+	}
+	setColumns := []string{"DurationSeconds", "DistanceMeters", "HeartRate", "Calories"}
+
+	register(Migration{
+		Version: 4,
+		Name:    "measurement_types",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&Exercise{}, "Measurement"); err != nil {
+				return err
+			}
+			for _, column := range setColumns {
+				if err := tx.Migrator().AddColumn(&Set{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range setColumns {
+				if err := tx.Migrator().DropColumn(&Set{}, column); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropColumn(&Exercise{}, "Measurement")
+		},
+	})
+}
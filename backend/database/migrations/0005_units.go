@@ -0,0 +1,30 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// weights stay stored in kilograms; users get a preferred unit and sets remember the unit they were logged in
+func init() {
+	type User struct {
+		PreferredUnit string `gorm:"not null;default:kg"`
+	}
+	type Set struct {
+		EnteredUnit string `gorm:"not null;default:kg"`
+	}
+
+	register(Migration{
+		Version: 5,
+		Name:    "units",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&User{}, "PreferredUnit"); err != nil {
+				return err
+			}
+			return tx.Migrator().AddColumn(&Set{}, "EnteredUnit")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&Set{}, "EnteredUnit"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&User{}, "PreferredUnit")
+		},
+	})
+}
@@ -0,0 +1,110 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// classifies exercises by muscle groups, equipment, movement pattern, mechanic and force, and seeds the
+// muscle group and equipment reference
+func init() {
+	type MuscleGroup struct {
+		Key    string `gorm:"primaryKey"`
+		Name   string `gorm:"not null"`
+		Region string
+	}
+	type Equipment struct {
+		Key  string `gorm:"primaryKey"`
+		Name string `gorm:"not null"`
+	}
+	type ExerciseMuscle struct {
+		ExerciseID     uint   `gorm:"primaryKey"`
+		MuscleGroupKey string `gorm:"primaryKey"`
+	}
+	type ExerciseEquipment struct {
+		ExerciseID   uint   `gorm:"primaryKey"`
+		EquipmentKey string `gorm:"primaryKey"`
+	}
+	type Exercise struct {
+		MovementPattern string
+		Mechanic        string
+		Force           string
+	}
+	exerciseColumns := []string{"MovementPattern", "Mechanic", "Force"}
+	joinTables := map[string]interface{}{
+		"exercise_primary_muscles":   &ExerciseMuscle{},
+		"exercise_secondary_muscles": &ExerciseMuscle{},
+		"exercise_equipment":         &ExerciseEquipment{},
+	}
+
+	muscleGroups := []MuscleGroup{
+		{"chest", "Chest", "upper"},
+		{"shoulders", "Shoulders", "upper"},
+		{"triceps", "Triceps", "upper"},
+		{"biceps", "Biceps", "upper"},
+		{"forearms", "Forearms", "upper"},
+		{"lats", "Lats", "upper"},
+		{"upper_back", "Upper back", "upper"},
+		{"traps", "Traps", "upper"},
+		{"neck", "Neck", "upper"},
+		{"abs", "Abs", "core"},
+		{"obliques", "Obliques", "core"},
+		{"lower_back", "Lower back", "core"},
+		{"glutes", "Glutes", "lower"},
+		{"quadriceps", "Quadriceps", "lower"},
+		{"hamstrings", "Hamstrings", "lower"},
+		{"adductors", "Adductors", "lower"},
+		{"abductors", "Abductors", "lower"},
+		{"calves", "Calves", "lower"},
+	}
+	equipment := []Equipment{
+		{"barbell", "Barbell"},
+		{"dumbbell", "Dumbbell"},
+		{"kettlebell", "Kettlebell"},
+		{"ez_bar", "EZ bar"},
+		{"trap_bar", "Trap bar"},
+		{"cable", "Cable"},
+		{"machine", "Machine"},
+		{"smith_machine", "Smith machine"},
+		{"bench", "Bench"},
+		{"pull_up_bar", "Pull-up bar"},
+		{"resistance_band", "Resistance band"},
+		{"medicine_ball", "Medicine ball"},
+		{"cardio_machine", "Cardio machine"},
+		{"bodyweight", "Bodyweight"},
+	}
+
+	register(Migration{
+		Version: 6,
+		Name:    "exercise_taxonomy",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&MuscleGroup{}, &Equipment{}); err != nil {
+				return err
+			}
+			for table, model := range joinTables {
+				if err := tx.Table(table).Migrator().CreateTable(model); err != nil {
+					return err
+				}
+			}
+			for _, column := range exerciseColumns {
+				if err := tx.Migrator().AddColumn(&Exercise{}, column); err != nil {
+					return err
+				}
+			}
+			if err := tx.Create(&muscleGroups).Error; err != nil {
+				return err
+			}
+			return tx.Create(&equipment).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range exerciseColumns {
+				if err := tx.Migrator().DropColumn(&Exercise{}, column); err != nil {
+					return err
+				}
+			}
+			for table := range joinTables {
+				if err := tx.Migrator().DropTable(table); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropTable(&Equipment{}, &MuscleGroup{})
+		},
+	})
+}
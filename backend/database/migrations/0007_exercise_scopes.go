@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// splits exercises into the global catalog, curated by admins, and custom exercises of one user. Existing exercises
+// become global; names that only differ in case are made unique before the index enforces it.
+func init() {
+	type Exercise struct {
+		ID     uint
+		Name   string
+		UserID *uint `gorm:"index"`
+	}
+	type User struct {
+		IsAdmin bool `gorm:"not null;default:false"`
+	}
+	const index = "idx_exercises_scope_name"
+
+	register(Migration{
+		Version: 7,
+		Name:    "exercise_scopes",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&Exercise{}, "UserID"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateIndex(&Exercise{}, "UserID"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().AddColumn(&User{}, "IsAdmin"); err != nil {
+				return err
+			}
+
+			var exercises []Exercise
+			if err := tx.Where("deleted_at IS NULL").Order("id").Find(&exercises).Error; err != nil {
+				return err
+			}
+			seen := map[string]bool{}
+			for _, exercise := range exercises {
+				name := strings.ToLower(exercise.Name)
+				if !seen[name] {
+					seen[name] = true
+					continue
+				}
+				renamed := fmt.Sprintf("%s (%d)", exercise.Name, exercise.ID)
+				if err := tx.Model(&Exercise{}).Where("id = ?", exercise.ID).Update("name", renamed).Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.Exec("CREATE UNIQUE INDEX " + index + " ON exercises (COALESCE(user_id, 0), LOWER(name)) WHERE deleted_at IS NULL").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Exec("DROP INDEX " + index).Error; err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&User{}, "IsAdmin"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropIndex(&Exercise{}, "UserID"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&Exercise{}, "UserID")
+		},
+	})
+}
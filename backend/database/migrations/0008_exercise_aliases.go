@@ -0,0 +1,24 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// aliases keep the names of exercises merged into another one
+func init() {
+	type ExerciseAlias struct {
+		gorm.Model
+		ExerciseID uint   `gorm:"not null;index"`
+		UserID     *uint  `gorm:"index"`
+		Name       string `gorm:"not null"`
+	}
+
+	register(Migration{
+		Version: 8,
+		Name:    "exercise_aliases",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&ExerciseAlias{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&ExerciseAlias{})
+		},
+	})
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// trigram indexes for the exercise search on Postgres. Creating the pg_trgm extension needs more rights than the
+// rest of the schema, so the migration goes on without it and the search then does all matching in the app.
+// SQLite has no trigram support, nothing changes there.
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "exercise_search",
+		Up: func(tx *gorm.DB) error {
+			if tx.Dialector.Name() != "postgres" {
+				return nil
+			}
+			// in a savepoint, a failed statement would abort the whole migration transaction otherwise
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				return tx.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error
+			})
+			if err != nil {
+				return nil
+			}
+			if err := tx.Exec("CREATE INDEX idx_exercises_name_trgm ON exercises USING gin (LOWER(name) gin_trgm_ops)").Error; err != nil {
+				return err
+			}
+			return tx.Exec("CREATE INDEX idx_exercise_aliases_name_trgm ON exercise_aliases USING gin (LOWER(name) gin_trgm_ops)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if tx.Dialector.Name() != "postgres" {
+				return nil
+			}
+			if err := tx.Exec("DROP INDEX IF EXISTS idx_exercise_aliases_name_trgm").Error; err != nil {
+				return err
+			}
+			// the extension stays, other databases of the server may use it
+			return tx.Exec("DROP INDEX IF EXISTS idx_exercises_name_trgm").Error
+		},
+	})
+}
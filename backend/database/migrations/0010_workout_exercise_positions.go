@@ -0,0 +1,28 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// workout exercises get an explicit position within their workout. Existing ones are numbered in the order they
+// were added, which is the order the details returned them in so far.
+func init() {
+	type WorkoutExercise struct {
+		Position int `gorm:"not null;default:0"`
+	}
+
+	register(Migration{
+		Version: 10,
+		Name:    "workout_exercise_positions",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&WorkoutExercise{}, "Position"); err != nil {
+				return err
+			}
+			return tx.Exec(`UPDATE workout_exercises SET position = (
+				SELECT COUNT(*) FROM workout_exercises earlier
+				WHERE earlier.workout_id = workout_exercises.workout_id AND earlier.id <= workout_exercises.id
+			)`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&WorkoutExercise{}, "Position")
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// workout exercises can be grouped into supersets, giant sets, circuits and EMOMs
+func init() {
+	type WorkoutExercise struct {
+		GroupID   *uint
+		GroupType string
+	}
+
+	register(Migration{
+		Version: 11,
+		Name:    "exercise_groups",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&WorkoutExercise{}, "GroupID"); err != nil {
+				return err
+			}
+			return tx.Migrator().AddColumn(&WorkoutExercise{}, "GroupType")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&WorkoutExercise{}, "GroupType"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&WorkoutExercise{}, "GroupID")
+		},
+	})
+}
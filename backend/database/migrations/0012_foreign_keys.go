@@ -0,0 +1,251 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// foreign keys for every relationship. Every key restricts deletes: rows are soft deleted, which the database sees
+// as an update, so an ON DELETE CASCADE would never fire. Deleting a user, workout or template soft deletes what it
+// owns in the repositories instead, in the same transaction, and the keys refuse a hard delete of any row that is
+// still referred to. Rows whose parent is already gone are deleted and rows whose owner was soft deleted are soft
+// deleted before the keys are added.
+func init() {
+	type User struct {
+		ID uint
+	}
+	type MuscleGroup struct {
+		Key string `gorm:"primaryKey"`
+	}
+	type Equipment struct {
+		Key string `gorm:"primaryKey"`
+	}
+	type Exercise struct {
+		ID     uint
+		UserID *uint
+		User   *User `gorm:"constraint:fk_exercises_user,OnDelete:RESTRICT"`
+	}
+	type ExerciseAlias struct {
+		ID         uint
+		ExerciseID uint
+		Exercise   Exercise `gorm:"constraint:fk_exercise_aliases_exercise,OnDelete:RESTRICT"`
+		UserID     *uint
+		User       *User `gorm:"constraint:fk_exercise_aliases_user,OnDelete:RESTRICT"`
+	}
+	type ExerciseMuscle struct {
+		ExerciseID     uint
+		Exercise       Exercise `gorm:"constraint:OnDelete:RESTRICT"`
+		MuscleGroupKey string
+		MuscleGroup    MuscleGroup `gorm:"constraint:OnDelete:RESTRICT"`
+	}
+	type ExerciseEquipment struct {
+		ExerciseID   uint
+		Exercise     Exercise `gorm:"constraint:fk_exercise_equipment_exercise,OnDelete:RESTRICT"`
+		EquipmentKey string
+		Equipment    Equipment `gorm:"constraint:fk_exercise_equipment_equipment,OnDelete:RESTRICT"`
+	}
+	type Workout struct {
+		ID     uint
+		UserID uint
+		User   User `gorm:"constraint:fk_workouts_user,OnDelete:RESTRICT"`
+	}
+	type WorkoutExercise struct {
+		ID         uint
+		WorkoutID  uint
+		Workout    Workout `gorm:"constraint:fk_workout_exercises_workout,OnDelete:RESTRICT"`
+		ExerciseID uint
+		Exercise   Exercise `gorm:"constraint:fk_workout_exercises_exercise,OnDelete:RESTRICT"`
+	}
+	type Set struct {
+		ID                uint
+		WorkoutExerciseID uint
+		WorkoutExercise   WorkoutExercise `gorm:"constraint:fk_sets_workout_exercise,OnDelete:RESTRICT"`
+	}
+	type PersonalRecord struct {
+		ID         uint
+		UserID     uint
+		User       User `gorm:"constraint:fk_personal_records_user,OnDelete:RESTRICT"`
+		ExerciseID uint
+		Exercise   Exercise `gorm:"constraint:fk_personal_records_exercise,OnDelete:RESTRICT"`
+		SetID      uint
+		Set        Set `gorm:"constraint:fk_personal_records_set,OnDelete:RESTRICT"`
+	}
+	type WorkoutTemplate struct {
+		ID     uint
+		UserID uint
+		User   User `gorm:"constraint:fk_workout_templates_user,OnDelete:RESTRICT"`
+	}
+	type TemplateExercise struct {
+		ID         uint
+		TemplateID uint
+		Template   WorkoutTemplate `gorm:"constraint:fk_template_exercises_template,OnDelete:RESTRICT"`
+		ExerciseID uint
+		Exercise   Exercise `gorm:"constraint:fk_template_exercises_exercise,OnDelete:RESTRICT"`
+	}
+
+	// a relationship: the column of table referring to the parent, and the field of model describing the key
+	type relation struct {
+		table, column, parent string
+		model                 interface{}
+		field                 string
+	}
+	// parents come before their children, so cleaning up a parent is seen by its children
+	relations := []relation{
+		{"exercises", "user_id", "users", &Exercise{}, "User"},
+		{"exercise_aliases", "exercise_id", "exercises", &ExerciseAlias{}, "Exercise"},
+		{"exercise_aliases", "user_id", "users", &ExerciseAlias{}, "User"},
+		{"exercise_primary_muscles", "exercise_id", "exercises", &ExerciseMuscle{}, "Exercise"},
+		{"exercise_primary_muscles", "muscle_group_key", "muscle_groups", &ExerciseMuscle{}, "MuscleGroup"},
+		{"exercise_secondary_muscles", "exercise_id", "exercises", &ExerciseMuscle{}, "Exercise"},
+		{"exercise_secondary_muscles", "muscle_group_key", "muscle_groups", &ExerciseMuscle{}, "MuscleGroup"},
+		{"exercise_equipment", "exercise_id", "exercises", &ExerciseEquipment{}, "Exercise"},
+		{"exercise_equipment", "equipment_key", "equipment", &ExerciseEquipment{}, "Equipment"},
+		{"workouts", "user_id", "users", &Workout{}, "User"},
+		{"workout_exercises", "workout_id", "workouts", &WorkoutExercise{}, "Workout"},
+		{"workout_exercises", "exercise_id", "exercises", &WorkoutExercise{}, "Exercise"},
+		{"sets", "workout_exercise_id", "workout_exercises", &Set{}, "WorkoutExercise"},
+		{"personal_records", "user_id", "users", &PersonalRecord{}, "User"},
+		{"personal_records", "exercise_id", "exercises", &PersonalRecord{}, "Exercise"},
+		{"personal_records", "set_id", "sets", &PersonalRecord{}, "Set"},
+		{"workout_templates", "user_id", "users", &WorkoutTemplate{}, "User"},
+		{"template_exercises", "template_id", "workout_templates", &TemplateExercise{}, "Template"},
+		{"template_exercises", "exercise_id", "exercises", &TemplateExercise{}, "Exercise"},
+	}
+	// the keys AutoMigrate created for has-many relationships, without any delete rule
+	replaced := []relation{
+		{table: "workouts", model: &Workout{}, field: "fk_users_workouts"},
+		{table: "workout_exercises", model: &WorkoutExercise{}, field: "fk_workouts_exercises"},
+		{table: "sets", model: &Set{}, field: "fk_workout_exercises_sets"},
+		{table: "template_exercises", model: &TemplateExercise{}, field: "fk_workout_templates_exercises"},
+	}
+	// reference tables keyed by a string rather than an ID, they are never soft deleted
+	keyed := map[string]bool{"muscle_groups": true, "equipment": true}
+	softDeleted := map[string]bool{"exercises": true, "exercise_aliases": true, "workouts": true, "workout_exercises": true,
+		"sets": true, "personal_records": true, "workout_templates": true, "template_exercises": true}
+	// the columns naming the owner of a row. Exercises and sets are only referred to, the workouts, templates and
+	// records referring to a soft deleted one are kept.
+	ownedBy := map[string]bool{"user_id": true, "workout_id": true, "workout_exercise_id": true, "template_id": true}
+	// the join tables share snapshot structs, so they are named explicitly
+	migrator := func(tx *gorm.DB, r relation) gorm.Migrator {
+		if r.table == "exercise_primary_muscles" || r.table == "exercise_secondary_muscles" || r.table == "exercise_equipment" {
+			return tx.Table(r.table).Migrator()
+		}
+		return tx.Migrator()
+	}
+
+	register(Migration{
+		Version: 12,
+		Name:    "foreign_keys",
+		Up: func(tx *gorm.DB) error {
+			for _, r := range relations {
+				parentKey := "id"
+				if keyed[r.parent] {
+					parentKey = "key"
+				}
+				err := tx.Exec("DELETE FROM " + r.table + " WHERE " + r.column + " IS NOT NULL AND " + r.column +
+					" NOT IN (SELECT " + parentKey + " FROM " + r.parent + ")").Error
+				if err != nil {
+					return err
+				}
+				if softDeleted[r.table] && ownedBy[r.column] {
+					err := tx.Exec("UPDATE " + r.table + " SET deleted_at = CURRENT_TIMESTAMP WHERE deleted_at IS NULL AND " +
+						r.column + " IN (SELECT id FROM " + r.parent + " WHERE deleted_at IS NOT NULL)").Error
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			for _, r := range replaced {
+				if err := rebuild(tx, r.table, func() error {
+					m := migrator(tx, r)
+					if !m.HasConstraint(r.model, r.field) {
+						return nil
+					}
+					return m.DropConstraint(r.model, r.field)
+				}); err != nil {
+					return err
+				}
+			}
+			for _, r := range relations {
+				if err := rebuild(tx, r.table, func() error {
+					return migrator(tx, r).CreateConstraint(r.model, r.field)
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for i := len(relations) - 1; i >= 0; i-- {
+				r := relations[i]
+				if err := rebuild(tx, r.table, func() error {
+					return migrator(tx, r).DropConstraint(r.model, r.field)
+				}); err != nil {
+					return err
+				}
+			}
+
+			type Set struct {
+				ID                uint
+				WorkoutExerciseID uint
+			}
+			type WorkoutExercise struct {
+				ID        uint
+				WorkoutID uint
+				Sets      []Set
+			}
+			type Workout struct {
+				ID        uint
+				UserID    uint
+				Exercises []WorkoutExercise
+			}
+			type User struct {
+				ID       uint
+				Workouts []Workout
+			}
+			type TemplateExercise struct {
+				ID         uint
+				TemplateID uint
+			}
+			type WorkoutTemplate struct {
+				ID        uint
+				Exercises []TemplateExercise `gorm:"foreignKey:TemplateID"`
+			}
+			for _, r := range []relation{
+				{table: "workouts", model: &User{}, field: "Workouts"},
+				{table: "workout_exercises", model: &Workout{}, field: "Exercises"},
+				{table: "sets", model: &WorkoutExercise{}, field: "Sets"},
+				{table: "template_exercises", model: &WorkoutTemplate{}, field: "Exercises"},
+			} {
+				// the parent's migrator, the keys belong to has-many relationships
+				if err := rebuild(tx, r.table, func() error {
+					return tx.Migrator().CreateConstraint(r.model, r.field)
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// rebuild runs change, which changes the constraints of table. SQLite does that by rebuilding the table, which loses
+// its indexes, so they are created again afterwards.
+func rebuild(tx *gorm.DB, table string, change func() error) error {
+	var indexes []string
+	if tx.Dialector.Name() == "sqlite" {
+		err := tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).
+			Scan(&indexes).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := change(); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if err := tx.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
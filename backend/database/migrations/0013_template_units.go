@@ -0,0 +1,23 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// template targets remember the unit they were planned in, like sets, and pass it on to the planned sets
+func init() {
+	type TemplateExercise struct {
+		EnteredUnit string `gorm:"not null;default:kg"`
+	}
+
+	register(Migration{
+		Version: 13,
+		Name:    "template_units",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&TemplateExercise{}, "EnteredUnit")
+		},
+		Down: func(tx *gorm.DB) error {
+			return rebuild(tx, "template_exercises", func() error {
+				return tx.Migrator().DropColumn(&TemplateExercise{}, "EnteredUnit")
+			})
+		},
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// usernames only have to be unique among users that are not deleted, so the name of a deleted account can be
+// registered again. Rolling back renames deleted users sharing their username with another user first.
+func init() {
+	const index = "idx_users_username"
+
+	register(Migration{
+		Version: 14,
+		Name:    "username_reuse",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("DROP INDEX " + index).Error; err != nil {
+				return err
+			}
+			return tx.Exec("CREATE UNIQUE INDEX " + index + " ON users (username) WHERE deleted_at IS NULL").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Exec("UPDATE users SET username = username || '-' || id WHERE deleted_at IS NOT NULL AND username IN " +
+				"(SELECT username FROM users GROUP BY username HAVING COUNT(*) > 1)").Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec("DROP INDEX " + index).Error; err != nil {
+				return err
+			}
+			return tx.Exec("CREATE UNIQUE INDEX " + index + " ON users (username)").Error
+		},
+	})
+}
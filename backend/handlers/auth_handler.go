@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"workout/auth"
+	"workout/models"
+	"workout/repo"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AuthHandler struct {
+	UserRepository repo.UserRepository
+	Tokens         *auth.TokenManager
+}
+
+type RegisterRequest struct {
+	Username      string
+	Name          string
+	Password      string
+	PreferredUnit models.Unit // kg when not given
+}
+
+type LoginRequest struct {
+	Username string
+	Password string
+}
+
+type RefreshRequest struct {
+	RefreshToken string
+}
+
+func NewAuthHandler(userRepo repo.UserRepository, tokens *auth.TokenManager) *AuthHandler {
+	return &AuthHandler{userRepo, tokens}
+}
+
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req RegisterRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username cannot be empty"})
+		return
+	}
+	if !models.ValidUsername(req.Username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username must be 3-30 letters, digits, '_', '.' or '-'"})
+		return
+	}
+	if req.PreferredUnit != "" && !req.PreferredUnit.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PreferredUnit must be kg or lb"})
+		return
+	}
+	if len(req.Password) < auth.MinPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Password must be at least %d characters", auth.MinPasswordLength)})
+		return
+	}
+
+	_, err = h.UserRepository.GetUserByUsername(req.Username)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already taken"})
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := models.User{
+		Username:      req.Username,
+		Name:          req.Name,
+		PasswordHash:  hash,
+		PreferredUnit: req.PreferredUnit,
+	}
+	err = h.UserRepository.CreateUser(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.Tokens.IssueTokens(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"user": user, "tokens": tokens})
+}
+
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req LoginRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// same error for unknown users and wrong passwords so usernames cannot be probed
+	user, err := h.UserRepository.GetUserByUsername(req.Username)
+	if err != nil || !auth.CheckPassword(user.PasswordHash, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+		return
+	}
+
+	tokens, err := h.Tokens.IssueTokens(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := h.Tokens.ParseToken(req.RefreshToken, auth.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the user may have been deleted since the refresh token was issued
+	_, err = h.UserRepository.GetUserByID(int(userID))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrInvalidToken.Error()})
+		return
+	}
+
+	tokens, err := h.Tokens.IssueTokens(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"workout/auth"
 	"workout/models"
 	"workout/repo"
 
@@ -10,13 +14,23 @@ import (
 )
 
 type ExerciseHandler struct {
-	ExerciseRepository *repo.ExerciseRepository
+	ExerciseRepository repo.ExerciseRepository
+	TaxonomyRepository repo.TaxonomyRepository
+	UserRepository     repo.UserRepository
+	RecordRepository   repo.RecordRepository
 }
 
-func NewExerciseHandler(exerciseRepo *repo.ExerciseRepository) *ExerciseHandler {
-	return &ExerciseHandler{exerciseRepo}
+// MergeRequest names the duplicate exercises merged into the exercise of the path
+type MergeRequest struct {
+	SourceIDs []uint
 }
 
+func NewExerciseHandler(exerciseRepo repo.ExerciseRepository, taxonomyRepo repo.TaxonomyRepository, userRepo repo.UserRepository, recordRepo repo.RecordRepository) *ExerciseHandler {
+	return &ExerciseHandler{exerciseRepo, taxonomyRepo, userRepo, recordRepo}
+}
+
+// CreateExercise creates a custom exercise of the user, or with ?scope=global an exercise of the global catalog,
+// which only admins may do.
 func (h *ExerciseHandler) CreateExercise(c *gin.Context) {
 	var exercise models.Exercise
 	err := c.ShouldBindJSON(&exercise)
@@ -29,8 +43,34 @@ func (h *ExerciseHandler) CreateExercise(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
 		return
 	}
+	if exercise.Measurement != "" && !exercise.Measurement.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown measurement type %q", exercise.Measurement)})
+		return
+	}
+	errs := exercise.ValidateMetadata()
+	if !h.checkTaxonomy(c, errs, exercise.PrimaryMuscles, exercise.SecondaryMuscles, exercise.Equipment) {
+		return
+	}
+
+	userID := auth.UserID(c)
+	exercise.UserID = &userID
+	switch c.Query("scope") {
+	case "", repo.ScopeCustom:
+	case repo.ScopeGlobal:
+		exercise.UserID = nil
+		if !h.authorizeCatalog(c, &exercise) {
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be global or custom"})
+		return
+	}
 
 	err = h.ExerciseRepository.CreateExercise(&exercise)
+	if errors.Is(err, repo.ErrDuplicateName) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -39,6 +79,61 @@ func (h *ExerciseHandler) CreateExercise(c *gin.Context) {
 	c.JSON(http.StatusCreated, exercise)
 }
 
+func (h *ExerciseHandler) ListExercises(c *gin.Context) {
+	page, ok := pageRequest(c)
+	if !ok {
+		return
+	}
+	filter := repo.ExerciseFilter{
+		NamePrefix:      c.Query("name_prefix"),
+		Muscle:          c.Query("muscle"),
+		Equipment:       c.Query("equipment"),
+		MovementPattern: models.MovementPattern(c.Query("pattern")),
+		Mechanic:        models.Mechanic(c.Query("mechanic")),
+		Force:           models.Force(c.Query("force")),
+		Scope:           c.Query("scope"),
+	}
+	if filter.Scope != "" && filter.Scope != repo.ScopeGlobal && filter.Scope != repo.ScopeCustom {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be global or custom"})
+		return
+	}
+
+	exercises, err := h.ExerciseRepository.ListExercises(auth.UserID(c), filter, page)
+	if err != nil {
+		respondListError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, exercises)
+}
+
+// SearchExercises looks exercises up by the q query parameter, tolerating typos and finding them by alias or by
+// abbreviations such as "ohp". The exercises the user does most often come first.
+func (h *ExerciseHandler) SearchExercises(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q cannot be empty"})
+		return
+	}
+	page, ok := pageRequest(c)
+	if !ok {
+		return
+	}
+	limit := page.Limit
+	switch {
+	case limit == 0:
+		limit = repo.DefaultPageSize
+	case limit > repo.MaxPageSize:
+		limit = repo.MaxPageSize
+	}
+
+	matches, err := h.ExerciseRepository.SearchExercises(auth.UserID(c), query, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, matches)
+}
+
 func (h *ExerciseHandler) GetExerciseByID(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -46,7 +141,7 @@ func (h *ExerciseHandler) GetExerciseByID(c *gin.Context) {
 		return
 	}
 
-	exercise, err := h.ExerciseRepository.GetExerciseByID(id)
+	exercise, err := h.ExerciseRepository.GetExerciseByID(auth.UserID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -62,20 +157,40 @@ func (h *ExerciseHandler) UpdateExercise(c *gin.Context) {
 		return
 	}
 
-	exercise, err := h.ExerciseRepository.GetExerciseByID(id)
+	exercise, err := h.ExerciseRepository.GetExerciseByID(auth.UserID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	var updates map[string]interface{}
-	err = c.ShouldBindJSON(&updates)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !h.authorizeCatalog(c, exercise) {
+		return
+	}
+
+	var patch models.ExercisePatch
+	if !bindPatch(c, &patch) {
+		return
+	}
+	var primary, secondary []models.MuscleGroup
+	var equipment []models.Equipment
+	if patch.PrimaryMuscles != nil {
+		primary = *patch.PrimaryMuscles
+	}
+	if patch.SecondaryMuscles != nil {
+		secondary = *patch.SecondaryMuscles
+	}
+	if patch.Equipment != nil {
+		equipment = *patch.Equipment
+	}
+	if !h.checkTaxonomy(c, models.FieldErrors{}, primary, secondary, equipment) {
 		return
 	}
 
-	err = h.ExerciseRepository.UpdateExercise(exercise, updates)
+	err = h.ExerciseRepository.UpdateExercise(exercise, patch.Updates(), patch.Associations())
+	if errors.Is(err, repo.ErrDuplicateName) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -91,9 +206,188 @@ func (h *ExerciseHandler) DeleteExercise(c *gin.Context) {
 		return
 	}
 
-	if err := h.ExerciseRepository.DeleteExercise(id); err != nil {
+	exercise, err := h.ExerciseRepository.GetExerciseByID(auth.UserID(c), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.authorizeCatalog(c, exercise) {
+		return
+	}
+
+	err = h.ExerciseRepository.DeleteExercise(exercise)
+	if errors.Is(err, repo.ErrExerciseInUse) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Exercise deleted"})
 }
+
+// MergeExercises consolidates duplicates: everything logged or planned with the source exercises moves to the :id
+// exercise, the records of the affected users are recomputed and the source names stay searchable as aliases.
+// Merging away a global exercise changes every user's history, so it takes an admin like any other catalog change.
+func (h *ExerciseHandler) MergeExercises(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
+		return
+	}
+
+	var request MergeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(request.SourceIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SourceIDs cannot be empty"})
+		return
+	}
+
+	userID := auth.UserID(c)
+	target, err := h.ExerciseRepository.GetExerciseByID(userID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	errs := models.FieldErrors{}
+	var sources []models.Exercise
+	seen := map[uint]bool{}
+	for i, sourceID := range request.SourceIDs {
+		field := fmt.Sprintf("SourceIDs[%d]", i)
+		if sourceID == target.ID {
+			errs[field] = "cannot merge an exercise into itself"
+			continue
+		}
+		if seen[sourceID] {
+			errs[field] = "duplicate exercise"
+			continue
+		}
+		seen[sourceID] = true
+
+		source, err := h.ExerciseRepository.GetExerciseByID(userID, int(sourceID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("exercise %d: %s", sourceID, err.Error())})
+			return
+		}
+		if !h.authorizeCatalog(c, source) {
+			return
+		}
+		switch {
+		case source.UserID == nil && target.UserID != nil:
+			errs[field] = "a global exercise can only be merged into a global exercise"
+		case source.Measurement != target.Measurement:
+			errs[field] = fmt.Sprintf("measured as %s, not %s", source.Measurement, target.Measurement)
+		}
+		sources = append(sources, *source)
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": errs})
+		return
+	}
+
+	userIDs, err := h.ExerciseRepository.MergeExercises(target, sources)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, affected := range userIDs {
+		if _, err := h.RecordRepository.RecomputeRecords(affected, target.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	merged, err := h.ExerciseRepository.GetExerciseByID(userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, merged)
+}
+
+// ListMuscleGroups lists the muscle group reference exercises are classified by
+func (h *ExerciseHandler) ListMuscleGroups(c *gin.Context) {
+	groups, err := h.TaxonomyRepository.ListMuscleGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+// ListEquipment lists the equipment reference exercises are classified by
+func (h *ExerciseHandler) ListEquipment(c *gin.Context) {
+	equipment, err := h.TaxonomyRepository.ListEquipment()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, equipment)
+}
+
+// checkTaxonomy adds an error to errs for every muscle group or equipment key that is not in the reference. It writes
+// the error response itself and returns false when errs is not empty.
+func (h *ExerciseHandler) checkTaxonomy(c *gin.Context, errs models.FieldErrors, primary, secondary []models.MuscleGroup, equipment []models.Equipment) bool {
+	if len(primary)+len(secondary)+len(equipment) > 0 {
+		groups, err := h.TaxonomyRepository.ListMuscleGroups()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		known, err := h.TaxonomyRepository.ListEquipment()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+
+		muscleKeys := map[string]bool{}
+		for _, group := range groups {
+			muscleKeys[group.Key] = true
+		}
+		equipmentKeys := map[string]bool{}
+		for _, e := range known {
+			equipmentKeys[e.Key] = true
+		}
+		for field, muscles := range map[string][]models.MuscleGroup{"PrimaryMuscles": primary, "SecondaryMuscles": secondary} {
+			for i, muscle := range muscles {
+				if !muscleKeys[muscle.Key] {
+					errs[fmt.Sprintf("%s[%d].Key", field, i)] = fmt.Sprintf("unknown muscle group %q", muscle.Key)
+				}
+			}
+		}
+		for i, e := range equipment {
+			if !equipmentKeys[e.Key] {
+				errs[fmt.Sprintf("Equipment[%d].Key", i)] = fmt.Sprintf("unknown equipment %q", e.Key)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": errs})
+		return false
+	}
+	return true
+}
+
+// authorizeCatalog makes sure only admins change global exercises. Custom exercises are only ever loaded for their
+// owner. It writes the error response itself and returns false when the user may not change the exercise.
+func (h *ExerciseHandler) authorizeCatalog(c *gin.Context, exercise *models.Exercise) bool {
+	if exercise.UserID != nil {
+		return true
+	}
+	user, err := h.UserRepository.GetUserByID(int(auth.UserID(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can change the global catalog"})
+		return false
+	}
+	return true
+}
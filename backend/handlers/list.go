@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"workout/models"
+	"workout/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageRequest reads the limit, cursor and sort query parameters shared by every listing endpoint
+func pageRequest(c *gin.Context) (repo.PageRequest, bool) {
+	page := repo.PageRequest{
+		Cursor: c.Query("cursor"),
+		Sort:   c.Query("sort"),
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return page, false
+		}
+		page.Limit = n
+	}
+	return page, true
+}
+
+// queryDate parses a date query parameter given either as 2006-01-02 or as an RFC 3339 timestamp.
+// A plain date used as an upper bound covers that whole day.
+func queryDate(c *gin.Context, name string, upperBound bool) (*time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, true
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + " date"})
+		return nil, false
+	}
+	if upperBound {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, true
+}
+
+// querySetTypes reads the set_types and exclude_set_types query parameters, comma separated lists of set types that
+// analytics are computed from or leave out. It returns nil when neither is given.
+func querySetTypes(c *gin.Context) (*models.SetTypeFilter, bool) {
+	var filter models.SetTypeFilter
+	for name, types := range map[string]*[]models.SetType{"set_types": &filter.Include, "exclude_set_types": &filter.Exclude} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := models.ParseSetTypes(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		*types = parsed
+	}
+	if filter.Include == nil && filter.Exclude == nil {
+		return nil, true
+	}
+	return &filter, true
+}
+
+// respondListError maps errors from a repository listing to a response
+func respondListError(c *gin.Context, err error) {
+	if errors.Is(err, repo.ErrInvalidCursor) || errors.Is(err, repo.ErrInvalidSort) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
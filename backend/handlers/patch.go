@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"workout/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type patchRequest interface {
+	Validate() models.FieldErrors
+}
+
+// bindPatch decodes a partial update into patch. Fields the patch model does not declare are
+// rejected rather than ignored, and a 422 listing every rejected field is written when any fail.
+func bindPatch(c *gin.Context, patch patchRequest) bool {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(body, &fields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	errs := models.FieldErrors{}
+	allowed := reflect.TypeOf(patch).Elem()
+	for key := range fields {
+		if _, ok := allowed.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, key) }); !ok {
+			errs[key] = "field cannot be updated"
+		}
+	}
+
+	err = json.Unmarshal(body, patch)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		errs[typeErr.Field] = "invalid value"
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	for field, reason := range patch.Validate() {
+		errs[field] = reason
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": errs})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"workout/analytics"
+	"workout/models"
+	"workout/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProgressHandler struct {
+	SetRepository  repo.SetRepository
+	UserRepository repo.UserRepository // for the unit weights are shown in
+}
+
+func NewProgressHandler(setRepo repo.SetRepository, userRepo repo.UserRepository) *ProgressHandler {
+	return &ProgressHandler{setRepo, userRepo}
+}
+
+// GetExerciseProgress aggregates the user's sets of an exercise into a day, week or month series
+func (h *ProgressHandler) GetExerciseProgress(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	if !authorizeUser(c, id) {
+		return
+	}
+	exerciseId, err := strconv.Atoi(c.Param("exercise_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
+		return
+	}
+
+	bucket, err := analytics.ParseBucket(c.Query("bucket"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	formula, err := analytics.ParseFormula(c.Query("formula"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, ok := queryDate(c, "from", false)
+	if !ok {
+		return
+	}
+	to, ok := queryDate(c, "to", true)
+	if !ok {
+		return
+	}
+
+	filter, ok := querySetTypes(c)
+	if !ok {
+		return
+	}
+	if filter == nil {
+		filter = &models.DefaultSetTypeFilter
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	sets, err := h.SetRepository.GetExerciseHistory(uint(id), uint(exerciseId), from, to, *filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, progressInUnit(analytics.Progress(formula, bucket, sets), display))
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"workout/analytics"
+	"workout/models"
+	"workout/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RecordHandler struct {
+	RecordRepository repo.RecordRepository
+	UserRepository   repo.UserRepository // for the unit weights are shown in
+}
+
+func NewRecordHandler(recordRepo repo.RecordRepository, userRepo repo.UserRepository) *RecordHandler {
+	return &RecordHandler{recordRepo, userRepo}
+}
+
+// GetRecordHistory lists every personal record the user set on an exercise, oldest first. The stored records leave
+// warm-ups out and estimate one-rep maxes with the default formula; asking for other set types or another formula
+// replays the history instead.
+func (h *RecordHandler) GetRecordHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	if !authorizeUser(c, id) {
+		return
+	}
+	exerciseId, err := strconv.Atoi(c.Param("exercise_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
+		return
+	}
+
+	formula, err := analytics.ParseFormula(c.Query("formula"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, ok := querySetTypes(c)
+	if !ok {
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	var records []models.PersonalRecord
+	if filter == nil && formula == analytics.DefaultFormula {
+		records, err = h.RecordRepository.ListRecords(uint(id), exerciseId, c.Query("type"))
+	} else {
+		if filter == nil {
+			filter = &models.DefaultSetTypeFilter
+		}
+		records, err = h.RecordRepository.ReplayRecords(uint(id), uint(exerciseId), *filter, formula)
+		records = filterRecordType(records, c.Query("type"))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, recordsInUnit(records, display))
+}
+
+func filterRecordType(records []models.PersonalRecord, recordType string) []models.PersonalRecord {
+	if recordType == "" {
+		return records
+	}
+	filtered := []models.PersonalRecord{}
+	for _, record := range records {
+		if record.Type == recordType {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
@@ -1,22 +1,28 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"workout/auth"
 	"workout/models"
 	"workout/repo"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type SetHandler struct {
-	SetRepository      *repo.SetRepository
-	ExerciseRepository *repo.WorkoutExerciseRepository
+	SetRepository      repo.SetRepository
+	ExerciseRepository repo.WorkoutExerciseRepository
+	RecordRepository   repo.RecordRepository
+	CatalogRepository  repo.ExerciseRepository // the exercises themselves, which declare how their sets are measured
+	UserRepository     repo.UserRepository     // for the unit weights are given and shown in
 }
 
-func NewSetHandler(setRepo *repo.SetRepository, exerciseRepo *repo.WorkoutExerciseRepository) *SetHandler {
-	return &SetHandler{setRepo, exerciseRepo}
+func NewSetHandler(setRepo repo.SetRepository, exerciseRepo repo.WorkoutExerciseRepository, recordRepo repo.RecordRepository, catalogRepo repo.ExerciseRepository, userRepo repo.UserRepository) *SetHandler {
+	return &SetHandler{setRepo, exerciseRepo, recordRepo, catalogRepo, userRepo}
 }
 
 func (h *SetHandler) AddSetToExercise(c *gin.Context) {
@@ -27,67 +33,176 @@ func (h *SetHandler) AddSetToExercise(c *gin.Context) {
 		return
 	}
 
-	if set.SetNumber < 1 {
+	if set.SetNumber < 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "set number must be greater than 0"})
+		return
+	}
+	if set.Type != "" && !set.Type.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown set type %q", set.Type)})
+		return
+	}
+	if set.Unit != "" && !set.Unit.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown unit %q", set.Unit)})
+		return
+	}
+	if errs := set.ValidateEffort(); len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": errs})
+		return
 	}
 
+	workoutId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
+		return
+	}
 	exerciseId, err := strconv.Atoi(c.Param("exercise_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
 		return
 	}
-	sets, err := h.SetRepository.GetSetsForExercise(exerciseId)
+
+	// the workout exercise has to be part of the workout in the path and owned by the user
+	userID := auth.UserID(c)
+	workoutExercise, err := h.ExerciseRepository.GetWorkoutExerciseByID(userID, workoutId, exerciseId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	for _, s := range sets {
-		if s.SetNumber == set.SetNumber {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%d already exists", set.SetNumber)})
-			return
-		}
+
+	if !h.validateMeasurement(c, workoutExercise, set) {
+		return
 	}
 
-	_, err = h.ExerciseRepository.GetWorkoutExerciseByID(exerciseId)
+	sets, err := h.SetRepository.GetSetsForExercise(userID, exerciseId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// sets are numbered without gaps, a new set is the next one and can be numbered by leaving SetNumber out
+	next := len(sets) + 1
+	if set.SetNumber == 0 {
+		set.SetNumber = next
+	}
+	if set.SetNumber != next {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("set number must be %d, the next set of the exercise", next)})
 		return
 	}
 
+	unit, ok := preferredUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+	set.FromUnit(unit)
+
 	set.WorkoutExerciseID = uint(exerciseId)
-	err = h.SetRepository.CreateSet(&set)
+	err = h.SetRepository.CreateSet(userID, &set)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, set)
+	records, err := h.RecordRepository.RecomputeRecords(userID, workoutExercise.ExerciseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	set.Records = nil
+	for _, record := range recordsInUnit(records, display) {
+		if record.SetID == set.ID {
+			set.Records = append(set.Records, record)
+		}
+	}
+
+	c.JSON(http.StatusCreated, set.InUnit(display))
 }
 
 func (h *SetHandler) GetSetByID(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	set, _, ok := h.setFromPath(c)
+	if !ok {
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, set.InUnit(display))
+}
+
+func (h *SetHandler) UpdateSet(c *gin.Context) {
+	set, workoutExercise, ok := h.setFromPath(c)
+	if !ok {
+		return
+	}
+
+	var patch models.SetPatch
+	if !bindPatch(c, &patch) {
+		return
+	}
+	unit, ok := preferredUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+	patch.FromUnit(unit)
+	if !h.validateMeasurement(c, workoutExercise, patch.Apply(*set)) {
+		return
+	}
+
+	// a set moves between the sets of its exercise, which shift to make room for it
+	userID := auth.UserID(c)
+	if patch.SetNumber != nil && *patch.SetNumber != set.SetNumber {
+		sets, err := h.SetRepository.GetSetsForExercise(userID, int(set.WorkoutExerciseID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if *patch.SetNumber > len(sets) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("set number must be between 1 and %d", len(sets))})
+			return
+		}
+	}
+
+	err := h.SetRepository.UpdateSet(userID, set, patch.Updates())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid set ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	set, err := h.SetRepository.GetSetByID(id)
+	_, err = h.RecordRepository.RecomputeRecords(userID, workoutExercise.ExerciseID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, set)
+	c.JSON(http.StatusOK, set.InUnit(display))
 }
 
 func (h *SetHandler) DeleteSet(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	set, workoutExercise, ok := h.setFromPath(c)
+	if !ok {
+		return
+	}
+
+	userID := auth.UserID(c)
+	err := h.SetRepository.DeleteSet(userID, int(set.WorkoutExerciseID), int(set.ID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid set ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	err = h.SetRepository.DeleteSet(id)
+	_, err = h.RecordRepository.RecomputeRecords(userID, workoutExercise.ExerciseID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -96,16 +211,89 @@ func (h *SetHandler) DeleteSet(c *gin.Context) {
 }
 
 func (h *SetHandler) GetSetsForExercise(c *gin.Context) {
+	workoutId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
+		return
+	}
 	exerciseId, err := strconv.Atoi(c.Param("exercise_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid set ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
+		return
+	}
+
+	page, ok := pageRequest(c)
+	if !ok {
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
 		return
 	}
 
-	sets, err := h.SetRepository.GetSetsForExercise(exerciseId)
+	userID := auth.UserID(c)
+	_, err = h.ExerciseRepository.GetWorkoutExerciseByID(userID, workoutId, exerciseId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	sets, err := h.SetRepository.ListSets(userID, exerciseId, page)
+	if err != nil {
+		respondListError(c, err)
 		return
 	}
+	for i, set := range sets.Items {
+		sets.Items[i] = set.InUnit(display)
+	}
 	c.JSON(http.StatusOK, sets)
 }
+
+// setFromPath loads the :set_id set and its workout exercise, making sure it belongs to the :exercise_id workout exercise of the
+// user's :id workout. It writes the error response itself and returns false when any of them do not match.
+func (h *SetHandler) setFromPath(c *gin.Context) (*models.Set, *models.WorkoutExercise, bool) {
+	workoutId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
+		return nil, nil, false
+	}
+	exerciseId, err := strconv.Atoi(c.Param("exercise_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
+		return nil, nil, false
+	}
+	id, err := strconv.Atoi(c.Param("set_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid set ID"})
+		return nil, nil, false
+	}
+
+	userID := auth.UserID(c)
+	workoutExercise, err := h.ExerciseRepository.GetWorkoutExerciseByID(userID, workoutId, exerciseId)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	set, err := h.SetRepository.GetSetByID(userID, exerciseId, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	return set, workoutExercise, true
+}
+
+// validateMeasurement checks the set against the measurement type of its exercise. It writes the error response
+// itself and returns false when the set does not fit.
+func (h *SetHandler) validateMeasurement(c *gin.Context, workoutExercise *models.WorkoutExercise, set models.Set) bool {
+	exercise, err := h.CatalogRepository.GetExerciseByID(auth.UserID(c), int(workoutExercise.ExerciseID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if errs := exercise.Measurement.ValidateSet(set); len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": errs})
+		return false
+	}
+	return true
+}
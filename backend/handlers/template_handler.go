@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"workout/auth"
+	"workout/models"
+	"workout/repo"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TemplateHandler struct {
+	TemplateRepository repo.TemplateRepository
+	ExerciseRepository repo.ExerciseRepository
+	WorkoutRepository  repo.WorkoutRepository
+	UserRepository     repo.UserRepository // for the unit target weights are given and shown in
+}
+
+// InstantiateRequest optionally overrides the name and performed date of a workout started from a template
+type InstantiateRequest struct {
+	Name        string
+	PerformedAt *time.Time
+}
+
+func NewTemplateHandler(templateRepo repo.TemplateRepository, exerciseRepo repo.ExerciseRepository, workoutRepo repo.WorkoutRepository, userRepo repo.UserRepository) *TemplateHandler {
+	return &TemplateHandler{templateRepo, exerciseRepo, workoutRepo, userRepo}
+}
+
+func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
+	var template models.WorkoutTemplate
+	err := c.ShouldBindJSON(&template)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if template.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
+		return
+	}
+	if !h.checkTemplateExercises(c, template.Exercises) {
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	template.ID = 0
+	template.UserID = auth.UserID(c)
+	err = h.TemplateRepository.CreateTemplate(&template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, template.InUnit(display))
+}
+
+func (h *TemplateHandler) ListTemplates(c *gin.Context) {
+	page, ok := pageRequest(c)
+	if !ok {
+		return
+	}
+
+	templates, err := h.TemplateRepository.ListTemplates(auth.UserID(c), page)
+	if err != nil {
+		respondListError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, templates)
+}
+
+func (h *TemplateHandler) GetTemplateByID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+
+	template, err := h.TemplateRepository.GetTemplateByID(auth.UserID(c), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, template.InUnit(display))
+}
+
+func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+
+	userID := auth.UserID(c)
+	template, err := h.TemplateRepository.GetTemplateByID(userID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var patch models.TemplatePatch
+	if !bindPatch(c, &patch) {
+		return
+	}
+	if patch.Exercises != nil && !h.checkTemplateExercises(c, *patch.Exercises) {
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	err = h.TemplateRepository.UpdateTemplate(userID, template, patch.Updates(), patch.Exercises)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, template.InUnit(display))
+}
+
+func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+
+	err = h.TemplateRepository.DeleteTemplate(auth.UserID(c), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted"})
+}
+
+// InstantiateTemplate starts a new workout from a template, with the target sets of every exercise pre-filled
+func (h *TemplateHandler) InstantiateTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+
+	var req InstantiateRequest
+	if c.Request.ContentLength > 0 {
+		err = c.ShouldBindJSON(&req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := auth.UserID(c)
+	template, err := h.TemplateRepository.GetTemplateByID(userID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	workout := models.Workout{
+		Name:   template.Name,
+		UserID: userID,
+	}
+	if req.Name != "" {
+		workout.Name = req.Name
+	}
+	if req.PerformedAt != nil {
+		workout.PerformedAt = *req.PerformedAt
+	}
+
+	err = h.TemplateRepository.InstantiateTemplate(template, &workout)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	workoutDetails, err := h.WorkoutRepository.GetWorkoutDetails(userID, int(workout.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, workoutDetails.InUnit(display))
+}
+
+// checkTemplateExercises validates the planned exercises, numbers them in the order given and converts their target
+// weights from their unit, or the user's preferred one, to kilograms. It writes the error response itself and returns
+// false when an exercise is invalid, does not exist or its targets do not fit how it is measured.
+func (h *TemplateHandler) checkTemplateExercises(c *gin.Context, exercises []models.TemplateExercise) bool {
+	if msg := models.ValidateTemplateExercises(exercises); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return false
+	}
+	errs := models.FieldErrors{}
+	for i := range exercises {
+		exercise, err := h.ExerciseRepository.GetExerciseByID(auth.UserID(c), int(exercises[i].ExerciseID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return false
+		}
+		for name, message := range exercises[i].ValidateTargets(exercise.Measurement) {
+			errs[fmt.Sprintf("Exercises[%d].%s", i, name)] = message
+		}
+		exercises[i].Model = gorm.Model{}
+		exercises[i].TemplateID = 0
+		exercises[i].Position = i + 1
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": errs})
+		return false
+	}
+
+	unit, ok := preferredUnit(c, h.UserRepository)
+	if !ok {
+		return false
+	}
+	for i := range exercises {
+		exercises[i].FromUnit(unit)
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"workout/analytics"
+	"workout/auth"
+	"workout/models"
+	"workout/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// preferredUnit looks up the unit the user logs weights in by default
+func preferredUnit(c *gin.Context, users repo.UserRepository) (models.Unit, bool) {
+	user, err := users.GetUserByID(int(auth.UserID(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return user.PreferredUnit, true
+}
+
+// displayUnit resolves the unit weights are returned in, the unit query parameter or else the user's preferred unit
+func displayUnit(c *gin.Context, users repo.UserRepository) (models.Unit, bool) {
+	if name := c.Query("unit"); name != "" {
+		unit, err := models.ParseUnit(name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return "", false
+		}
+		return unit, true
+	}
+	return preferredUnit(c, users)
+}
+
+// convertWeight converts a stored weight, or a weight times reps, to the unit. Records and progress do not remember
+// the unit their sets were entered in, so unlike sets they are not rounded to plates.
+func convertWeight(weight float64, unit models.Unit) float64 {
+	return models.DisplayWeight(weight, unit, unit)
+}
+
+// recordsInUnit converts the weights of the records, and the values of those measured in weight, to the unit
+func recordsInUnit(records []models.PersonalRecord, unit models.Unit) []models.PersonalRecord {
+	converted := make([]models.PersonalRecord, len(records))
+	for i, record := range records {
+		record.Weight = convertWeight(record.Weight, unit)
+		if analytics.RecordType(record.Type) != analytics.MostRepsAtWeight {
+			record.Value = convertWeight(record.Value, unit)
+		}
+		converted[i] = record
+	}
+	return converted
+}
+
+// progressInUnit converts the weights and volumes of the progress series to the unit
+func progressInUnit(series []analytics.ProgressPoint, unit models.Unit) []analytics.ProgressPoint {
+	converted := make([]analytics.ProgressPoint, len(series))
+	for i, point := range series {
+		point.TopSetWeight = convertWeight(point.TopSetWeight, unit)
+		point.TotalVolume = convertWeight(point.TotalVolume, unit)
+		point.BestE1RM = convertWeight(point.BestE1RM, unit)
+		converted[i] = point
+	}
+	return converted
+}
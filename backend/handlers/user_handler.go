@@ -1,50 +1,34 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"workout/auth"
 	"workout/models"
 	"workout/repo"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type UserHandler struct {
-	UserRepository *repo.UserRepository
+	UserRepository repo.UserRepository
 }
 
-func NewUserHandler(userRepo *repo.UserRepository) *UserHandler {
+func NewUserHandler(userRepo repo.UserRepository) *UserHandler {
 	return &UserHandler{userRepo}
 }
 
-func (h *UserHandler) CreateUser(c *gin.Context) {
-	var user models.User
-	err := c.ShouldBindJSON(&user)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	if user.Username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username cannot be empty"})
-		return
-	}
-
-	err = h.UserRepository.CreateUser(&user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusCreated, user)
-}
-
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
 		return
 	}
+	if !authorizeUser(c, id) {
+		return
+	}
 
 	user, err := h.UserRepository.GetUserByID(id)
 	if err != nil {
@@ -61,6 +45,9 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
 		return
 	}
+	if !authorizeUser(c, id) {
+		return
+	}
 
 	user, err := h.UserRepository.GetUserByID(id)
 	if err != nil {
@@ -68,15 +55,19 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	// updates the user struct based on the json given in the request
-	var updates map[string]interface{}
-	err = c.ShouldBindJSON(&updates)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var patch models.UserPatch
+	if !bindPatch(c, &patch) {
 		return
 	}
+	if patch.Username != nil {
+		existing, err := h.UserRepository.GetUserByUsername(*patch.Username)
+		if err == nil && existing.ID != user.ID {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already taken"})
+			return
+		}
+	}
 
-	err = h.UserRepository.UpdateUser(user, updates)
+	err = h.UserRepository.UpdateUser(user, patch.Updates())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -91,10 +82,27 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
 		return
 	}
+	if !authorizeUser(c, id) {
+		return
+	}
 
-	if err := h.UserRepository.DeleteUser(id); err != nil {
+	err = h.UserRepository.DeleteUser(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
 }
+
+// authorizeUser writes a 403 and returns false when the :id in the path is not the authenticated user
+func authorizeUser(c *gin.Context, id int) bool {
+	if uint(id) != auth.UserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return false
+	}
+	return true
+}
@@ -1,36 +1,93 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
+	"workout/auth"
 	"workout/models"
 	"workout/repo"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type WorkoutHandler struct {
-	WorkoutRepository  *repo.WorkoutRepository
-	ExerciseRepository *repo.ExerciseRepository
+	WorkoutRepository         repo.WorkoutRepository
+	ExerciseRepository        repo.ExerciseRepository
+	WorkoutExerciseRepository repo.WorkoutExerciseRepository
+	RecordRepository          repo.RecordRepository
+	UserRepository            repo.UserRepository
 }
 
-func NewWorkoutHandler(workoutRepo *repo.WorkoutRepository, exerciseRepo *repo.ExerciseRepository) *WorkoutHandler {
-	return &WorkoutHandler{workoutRepo, exerciseRepo}
+// WorkoutRequest holds the fields a client sets when creating a workout, exercises are added through their own routes
+type WorkoutRequest struct {
+	Name        string
+	PerformedAt time.Time
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+}
+
+// AddExerciseRequest names the exercise added to a workout, its sets are logged through the set routes
+type AddExerciseRequest struct {
+	ExerciseID uint
+}
+
+// ReorderRequest lists every workout exercise of a workout in the new order
+type ReorderRequest struct {
+	WorkoutExerciseIDs []uint
+}
+
+// SubstituteRequest names the exercise that replaces the one logged in a workout
+type SubstituteRequest struct {
+	ExerciseID uint
+}
+
+// GroupRequest names the workout exercises performed together as a group, in the order they are performed
+type GroupRequest struct {
+	Type               models.GroupType
+	WorkoutExerciseIDs []uint
+}
+
+func NewWorkoutHandler(workoutRepo repo.WorkoutRepository, exerciseRepo repo.ExerciseRepository, workoutExerciseRepo repo.WorkoutExerciseRepository, recordRepo repo.RecordRepository, userRepo repo.UserRepository) *WorkoutHandler {
+	return &WorkoutHandler{workoutRepo, exerciseRepo, workoutExerciseRepo, recordRepo, userRepo}
 }
 
 func (h *WorkoutHandler) CreateWorkout(c *gin.Context) {
-	var workout models.Workout
-	err := c.ShouldBindJSON(&workout)
+	var request WorkoutRequest
+	err := c.ShouldBindJSON(&request)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	workout := models.Workout{
+		Name:        request.Name,
+		PerformedAt: request.PerformedAt,
+		StartedAt:   request.StartedAt,
+		FinishedAt:  request.FinishedAt,
+	}
 
 	if workout.Name == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
 		return
 	}
 
+	if workout.StartedAt == nil && workout.FinishedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "FinishedAt requires StartedAt"})
+		return
+	}
+	if workout.StartedAt != nil && workout.FinishedAt != nil && workout.FinishedAt.Before(*workout.StartedAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "FinishedAt cannot be before StartedAt"})
+		return
+	}
+	if workout.PerformedAt.IsZero() && workout.StartedAt != nil {
+		workout.PerformedAt = *workout.StartedAt
+	}
+
+	// the owner always comes from the token, never from the request body
+	workout.UserID = auth.UserID(c)
 	err = h.WorkoutRepository.CreateWorkout(&workout)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -40,6 +97,109 @@ func (h *WorkoutHandler) CreateWorkout(c *gin.Context) {
 	c.JSON(http.StatusCreated, workout)
 }
 
+// CreateFullWorkout logs a whole session, shaped like the workout details, in a single request.
+// Nothing is created unless the workout, every exercise and every set are valid.
+func (h *WorkoutHandler) CreateFullWorkout(c *gin.Context) {
+	var details models.WorkoutDetails
+	err := c.ShouldBindJSON(&details)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	errs := details.ValidateForCreate()
+	for i, exercise := range details.Exercises {
+		if exercise.ID == 0 {
+			continue
+		}
+		stored, err := h.ExerciseRepository.GetExerciseByID(auth.UserID(c), int(exercise.ID))
+		if err != nil {
+			errs[fmt.Sprintf("Exercises[%d].ID", i)] = err.Error()
+			continue
+		}
+		for j, set := range exercise.Sets {
+			for name, message := range stored.Measurement.ValidateSet(set) {
+				errs[fmt.Sprintf("Exercises[%d].Sets[%d].%s", i, j, name)] = message
+			}
+		}
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": errs})
+		return
+	}
+
+	unit, ok := preferredUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	userID := auth.UserID(c)
+	workout := models.Workout{
+		Name:        details.Name,
+		UserID:      userID,
+		PerformedAt: details.PerformedAt,
+		StartedAt:   details.StartedAt,
+		FinishedAt:  details.FinishedAt,
+	}
+	if workout.PerformedAt.IsZero() && workout.StartedAt != nil {
+		workout.PerformedAt = *workout.StartedAt
+	}
+	exerciseIDs := map[uint]bool{}
+	for position, exercise := range details.Exercises {
+		workoutExercise := models.WorkoutExercise{
+			ExerciseID: exercise.ID,
+			Position:   position + 1,
+			GroupID:    exercise.GroupID,
+			GroupType:  exercise.GroupType,
+		}
+		for i, set := range exercise.Sets {
+			set.FromUnit(unit)
+			workoutExercise.Sets = append(workoutExercise.Sets, models.Set{
+				SetNumber:       i + 1,
+				Type:            set.Type,
+				Reps:            set.Reps,
+				Weight:          set.Weight,
+				EnteredUnit:     set.EnteredUnit,
+				RPE:             set.RPE,
+				RIR:             set.RIR,
+				Tempo:           set.Tempo,
+				Planned:         set.Planned,
+				DurationSeconds: set.DurationSeconds,
+				DistanceMeters:  set.DistanceMeters,
+				HeartRate:       set.HeartRate,
+				Calories:        set.Calories,
+			})
+		}
+		workout.Exercises = append(workout.Exercises, workoutExercise)
+		exerciseIDs[exercise.ID] = true
+	}
+
+	err = h.WorkoutRepository.CreateFullWorkout(&workout)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for exerciseID := range exerciseIDs {
+		_, err = h.RecordRepository.RecomputeRecords(userID, exerciseID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	workoutDetails, err := h.WorkoutRepository.GetWorkoutDetails(userID, int(workout.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, workoutDetails.InUnit(display))
+}
+
 func (h *WorkoutHandler) GetWorkoutByID(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -47,7 +207,7 @@ func (h *WorkoutHandler) GetWorkoutByID(c *gin.Context) {
 		return
 	}
 
-	workout, err := h.WorkoutRepository.GetWorkoutByID(id)
+	workout, err := h.WorkoutRepository.GetWorkoutByID(auth.UserID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -63,20 +223,82 @@ func (h *WorkoutHandler) UpdateWorkout(c *gin.Context) {
 		return
 	}
 
-	workout, err := h.WorkoutRepository.GetWorkoutByID(id)
+	workout, err := h.WorkoutRepository.GetWorkoutByID(auth.UserID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	var updates map[string]interface{}
-	err = c.ShouldBindJSON(&updates)
+	var patch models.WorkoutPatch
+	if !bindPatch(c, &patch) {
+		return
+	}
+	if errs := patch.ValidateTiming(workout); len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": errs})
+		return
+	}
+
+	err = h.WorkoutRepository.UpdateWorkout(auth.UserID(c), workout, patch.Updates())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workout)
+}
+
+// StartWorkout marks a workout as being performed now
+func (h *WorkoutHandler) StartWorkout(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
 		return
 	}
 
-	err = h.WorkoutRepository.UpdateWorkout(workout, updates)
+	userID := auth.UserID(c)
+	workout, err := h.WorkoutRepository.GetWorkoutByID(userID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if workout.StartedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "workout already started"})
+		return
+	}
+
+	now := time.Now()
+	err = h.WorkoutRepository.UpdateWorkout(userID, workout, map[string]interface{}{"started_at": now, "performed_at": now})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workout)
+}
+
+func (h *WorkoutHandler) FinishWorkout(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
+		return
+	}
+
+	userID := auth.UserID(c)
+	workout, err := h.WorkoutRepository.GetWorkoutByID(userID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if workout.StartedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "workout has not been started"})
+		return
+	}
+	if workout.FinishedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "workout already finished"})
+		return
+	}
+
+	err = h.WorkoutRepository.UpdateWorkout(userID, workout, map[string]interface{}{"finished_at": time.Now()})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -92,10 +314,25 @@ func (h *WorkoutHandler) DeleteWorkout(c *gin.Context) {
 		return
 	}
 
-	if err := h.WorkoutRepository.DeleteWorkout(id); err != nil {
+	userID := auth.UserID(c)
+	exerciseIDs, err := h.WorkoutRepository.DeleteWorkout(userID, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	// the deleted sets may have held records
+	for _, exerciseID := range exerciseIDs {
+		_, err = h.RecordRepository.RecomputeRecords(userID, exerciseID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Workout deleted"})
 }
 
@@ -107,15 +344,16 @@ func (h *WorkoutHandler) AddExerciseToWorkout(c *gin.Context) {
 		return
 	}
 
-	var workoutExercise models.WorkoutExercise
-	err = c.ShouldBindJSON(&workoutExercise)
+	var request AddExerciseRequest
+	err = c.ShouldBindJSON(&request)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	workoutExercise := models.WorkoutExercise{ExerciseID: request.ExerciseID}
 
 	// check that exercise and workout exists
-	_, err = h.WorkoutRepository.GetWorkoutByID(id)
+	_, err = h.WorkoutRepository.GetWorkoutByID(auth.UserID(c), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -124,14 +362,14 @@ func (h *WorkoutHandler) AddExerciseToWorkout(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
 		return
 	}
-	_, err = h.ExerciseRepository.GetExerciseByID(int(workoutExercise.ExerciseID))
+	_, err = h.ExerciseRepository.GetExerciseByID(auth.UserID(c), int(workoutExercise.ExerciseID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
 	workoutExercise.WorkoutID = uint(id)
-	err = h.ExerciseRepository.AddExerciseToWorkout(&workoutExercise)
+	err = h.WorkoutExerciseRepository.AddExerciseToWorkout(auth.UserID(c), &workoutExercise)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -140,18 +378,346 @@ func (h *WorkoutHandler) AddExerciseToWorkout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Exercise added to workout"})
 }
 
-func (h *WorkoutHandler) GetWorkoutDetails(c *gin.Context) {
+// ReorderWorkoutExercises moves the exercises of the workout into the order given. Every exercise of the workout has to
+// be listed once, so a client working from a stale list cannot silently drop one.
+func (h *WorkoutHandler) ReorderWorkoutExercises(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
+		return
+	}
+
+	var request ReorderRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	userID := auth.UserID(c)
+	err = h.WorkoutExerciseRepository.ReorderWorkoutExercises(userID, id, request.WorkoutExerciseIDs)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repo.ErrInvalidOrder):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": models.FieldErrors{"WorkoutExerciseIDs": err.Error()}})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	workoutDetails, err := h.WorkoutRepository.GetWorkoutDetails(userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, workoutDetails.InUnit(display))
+}
+
+// GroupExercises groups exercises of the workout into a superset, giant set, circuit or EMOM. The grouped exercises
+// move next to each other, where the first of them was.
+func (h *WorkoutHandler) GroupExercises(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
+		return
+	}
+
+	var request GroupRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	errs := models.FieldErrors{}
+	if !request.Type.Valid() {
+		errs["Type"] = "must be superset, giant_set, circuit or emom"
+	} else if msg := request.Type.ValidateSize(len(request.WorkoutExerciseIDs)); msg != "" {
+		errs["WorkoutExerciseIDs"] = msg
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": errs})
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	userID := auth.UserID(c)
+	_, err = h.WorkoutExerciseRepository.GroupWorkoutExercises(userID, id, request.Type, request.WorkoutExerciseIDs)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repo.ErrInvalidGroup):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": models.FieldErrors{"WorkoutExerciseIDs": err.Error()}})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	workoutDetails, err := h.WorkoutRepository.GetWorkoutDetails(userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, workoutDetails.InUnit(display))
+}
+
+// UngroupExercises splits the :group_id group of the workout up, leaving its exercises where they are
+func (h *WorkoutHandler) UngroupExercises(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
+		return
+	}
+	groupID, err := strconv.Atoi(c.Param("group_id"))
+	if err != nil || groupID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	userID := auth.UserID(c)
+	err = h.WorkoutExerciseRepository.UngroupWorkoutExercises(userID, id, uint(groupID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	workoutDetails, err := h.WorkoutRepository.GetWorkoutDetails(userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, workoutDetails.InUnit(display))
+}
+
+// RemoveExerciseFromWorkout removes the :exercise_id workout exercise together with its sets
+func (h *WorkoutHandler) RemoveExerciseFromWorkout(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
 		return
 	}
+	exerciseID, err := strconv.Atoi(c.Param("exercise_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
+		return
+	}
+
+	userID := auth.UserID(c)
+	workoutExercise, err := h.WorkoutExerciseRepository.GetWorkoutExerciseByID(userID, id, exerciseID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.WorkoutExerciseRepository.DeleteWorkoutExercise(userID, workoutExercise)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	workoutDetails, err := h.WorkoutRepository.GetWorkoutDetails(id)
+	// the removed sets may have held records
+	_, err = h.RecordRepository.RecomputeRecords(userID, workoutExercise.ExerciseID)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Exercise removed from workout"})
+}
+
+// SubstituteExercise replaces the movement of the :exercise_id workout exercise, for example when the planned machine
+// was taken, keeping the sets already logged. The sets have to fit how the new exercise is measured.
+func (h *WorkoutHandler) SubstituteExercise(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
+		return
+	}
+	workoutExerciseID, err := strconv.Atoi(c.Param("exercise_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
+		return
+	}
+
+	var request SubstituteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if request.ExerciseID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
+		return
+	}
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
 
-	c.JSON(http.StatusOK, workoutDetails)
+	userID := auth.UserID(c)
+	workoutExercise, err := h.WorkoutExerciseRepository.GetWorkoutExerciseByID(userID, id, workoutExerciseID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	exercise, err := h.ExerciseRepository.GetExerciseByID(userID, int(request.ExerciseID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	workoutDetails, err := h.WorkoutRepository.GetWorkoutDetails(userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	errs := models.FieldErrors{}
+	if exercise.ID == workoutExercise.ExerciseID {
+		errs["ExerciseID"] = "is already the exercise"
+	}
+	for _, details := range workoutDetails.Exercises {
+		if details.WorkoutExerciseID != workoutExercise.ID {
+			continue
+		}
+		for i, set := range details.Sets {
+			for name, message := range exercise.Measurement.ValidateSet(set) {
+				errs[fmt.Sprintf("Sets[%d].%s", i, name)] = message
+			}
+		}
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid fields", "fields": errs})
+		return
+	}
+
+	previousID := workoutExercise.ExerciseID
+	err = h.WorkoutExerciseRepository.SubstituteExercise(userID, workoutExercise, exercise.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// the sets count towards the records of the new exercise instead of the old one
+	for _, recomputeID := range []uint{previousID, exercise.ID} {
+		_, err = h.RecordRepository.RecomputeRecords(userID, recomputeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	workoutDetails, err = h.WorkoutRepository.GetWorkoutDetails(userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, workoutDetails.InUnit(display))
+}
+
+func (h *WorkoutHandler) GetWorkoutDetails(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
+		return
+	}
+
+	display, ok := displayUnit(c, h.UserRepository)
+	if !ok {
+		return
+	}
+
+	workoutDetails, err := h.WorkoutRepository.GetWorkoutDetails(auth.UserID(c), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workoutDetails.InUnit(display))
+}
+
+func (h *WorkoutHandler) ListWorkouts(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	if !authorizeUser(c, id) {
+		return
+	}
+
+	page, ok := pageRequest(c)
+	if !ok {
+		return
+	}
+	var filter repo.WorkoutFilter
+	if filter.From, ok = queryDate(c, "from", false); !ok {
+		return
+	}
+	if filter.To, ok = queryDate(c, "to", true); !ok {
+		return
+	}
+	if exerciseId := c.Query("exercise_id"); exerciseId != "" {
+		filter.ExerciseID, err = strconv.Atoi(exerciseId)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exercise ID"})
+			return
+		}
+	}
+	filter.NamePrefix = c.Query("name_prefix")
+
+	workouts, err := h.WorkoutRepository.ListWorkouts(uint(id), filter, page)
+	if err != nil {
+		respondListError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, workouts)
+}
+
+func (h *WorkoutHandler) ListWorkoutExercises(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workout ID"})
+		return
+	}
+
+	page, ok := pageRequest(c)
+	if !ok {
+		return
+	}
+
+	userID := auth.UserID(c)
+	_, err = h.WorkoutRepository.GetWorkoutByID(userID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	exercises, err := h.WorkoutExerciseRepository.ListWorkoutExercises(userID, id, page)
+	if err != nil {
+		respondListError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, exercises)
 }
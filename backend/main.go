@@ -4,49 +4,52 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"workout/auth"
+	"workout/database"
+	"workout/database/migrations"
 	"workout/handlers"
-	"workout/models"
 	"workout/repo"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
-var db *gorm.DB
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
 
-func init() {
+func main() {
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
-	var (
-		host     = os.Getenv("DB_HOST")
-		user     = os.Getenv("DB_USER")
-		password = os.Getenv("DB_PASSWORD")
-		dbname   = os.Getenv("DB_NAME")
-		port     = os.Getenv("DB_PORT")
-		sslmode  = os.Getenv("DB_SSLMODE")
-	)
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-		host, user, password, dbname, port, sslmode)
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+
+	cfg := database.ConfigFromEnv(false)
+	db, err := database.Open(cfg)
 	if err != nil {
-		panic("failed to connect to database")
+		log.Fatalf("failed to connect to database: %v", err)
 	}
+	fmt.Printf("Connected to %s!\n", cfg.Driver)
 
-	db.AutoMigrate(&models.User{})
-	db.AutoMigrate(&models.Exercise{})
-	db.AutoMigrate(&models.Workout{})
-	db.AutoMigrate(&models.WorkoutExercise{})
-	db.AutoMigrate(&models.Set{})
-}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(db, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-func main() {
-	fmt.Println("Connected to PostgreSQL!")
+	if err := migrations.Check(db); err != nil {
+		log.Fatalf("%v, run `%s migrate up` first", err, os.Args[0])
+	}
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		log.Fatal("JWT_SECRET must be set")
+	}
 
 	// repos
 	userRepo := repo.NewUserRepository(db)
@@ -54,45 +57,94 @@ func main() {
 	workoutRepo := repo.NewWorkoutRepository(db)
 	setRepo := repo.NewSetRepository(db)
 	workoutExerciseRepo := repo.NewWorkoutExerciseRepository(db)
+	recordRepo := repo.NewRecordRepository(db)
+	templateRepo := repo.NewTemplateRepository(db)
+	taxonomyRepo := repo.NewTaxonomyRepository(db)
+
+	tokens := auth.NewTokenManager(jwtSecret, accessTokenTTL, refreshTokenTTL)
 
 	// handlers
+	authHandler := handlers.NewAuthHandler(userRepo, tokens)
 	userHandler := handlers.NewUserHandler(userRepo)
-	exerciseHandler := handlers.NewExerciseHandler(exerciseRepo)
-	workoutHandler := handlers.NewWorkoutHandler(workoutRepo, exerciseRepo)
-	setHandler := handlers.NewSetHandler(setRepo, workoutExerciseRepo)
+	exerciseHandler := handlers.NewExerciseHandler(exerciseRepo, taxonomyRepo, userRepo, recordRepo)
+	workoutHandler := handlers.NewWorkoutHandler(workoutRepo, exerciseRepo, workoutExerciseRepo, recordRepo, userRepo)
+	setHandler := handlers.NewSetHandler(setRepo, workoutExerciseRepo, recordRepo, exerciseRepo, userRepo)
+	recordHandler := handlers.NewRecordHandler(recordRepo, userRepo)
+	progressHandler := handlers.NewProgressHandler(setRepo, userRepo)
+	templateHandler := handlers.NewTemplateHandler(templateRepo, exerciseRepo, workoutRepo, userRepo)
 
 	r := gin.Default()
 
 	// Enable CORS for the router
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Content-Type"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowHeaders:     []string{"Content-Type", "Authorization"},
 		AllowCredentials: true,
 	}))
 
+	// auth
+	r.POST("/auth/register", authHandler.Register)
+	r.POST("/auth/login", authHandler.Login)
+	r.POST("/auth/refresh", authHandler.Refresh)
+
+	// everything below requires a valid access token
+	api := r.Group("/", auth.Middleware(tokens, userRepo))
+
 	// user
-	r.POST("/users", userHandler.CreateUser)
-	r.GET("/users/:id", userHandler.GetUserByID)
-	r.PUT("/users/:id", userHandler.UpdateUser)
-	r.DELETE("/users/:id", userHandler.DeleteUser)
+	api.GET("/users/:id", userHandler.GetUserByID)
+	api.GET("/users/:id/workouts", workoutHandler.ListWorkouts)
+	api.GET("/users/:id/exercises/:exercise_id/records", recordHandler.GetRecordHistory)
+	api.GET("/users/:id/exercises/:exercise_id/progress", progressHandler.GetExerciseProgress)
+	api.PUT("/users/:id", userHandler.UpdateUser)
+	api.PATCH("/users/:id", userHandler.UpdateUser)
+	api.DELETE("/users/:id", userHandler.DeleteUser)
 
 	// exercise
-	r.POST("/exercises", exerciseHandler.CreateExercise)
-	r.GET("/exercises/:id", exerciseHandler.GetExerciseByID)
-	r.PUT("/exercises/:id", exerciseHandler.UpdateExercise)
-	r.DELETE("/exercises/:id", exerciseHandler.DeleteExercise)
+	api.GET("/exercises", exerciseHandler.ListExercises)
+	api.GET("/muscle-groups", exerciseHandler.ListMuscleGroups)
+	api.GET("/equipment", exerciseHandler.ListEquipment)
+	api.POST("/exercises", exerciseHandler.CreateExercise)
+	api.GET("/exercises/search", exerciseHandler.SearchExercises)
+	api.GET("/exercises/:id", exerciseHandler.GetExerciseByID)
+	api.PUT("/exercises/:id", exerciseHandler.UpdateExercise)
+	api.PATCH("/exercises/:id", exerciseHandler.UpdateExercise)
+	api.DELETE("/exercises/:id", exerciseHandler.DeleteExercise)
+	api.POST("/exercises/:id/merge", exerciseHandler.MergeExercises)
 
 	// workout
-	r.POST("/workouts", workoutHandler.CreateWorkout)
-	r.POST("/workouts/:id/exercises", workoutHandler.AddExerciseToWorkout)
-	r.GET("/workouts/:id", workoutHandler.GetWorkoutDetails)
-	r.PUT("/workouts/:id", workoutHandler.UpdateWorkout)
-	r.DELETE("/workouts/:id", workoutHandler.DeleteWorkout)
+	api.POST("/workouts", workoutHandler.CreateWorkout)
+	api.POST("/workouts/full", workoutHandler.CreateFullWorkout)
+	api.GET("/workouts/:id/exercises", workoutHandler.ListWorkoutExercises)
+	api.POST("/workouts/:id/exercises", workoutHandler.AddExerciseToWorkout)
+	api.PUT("/workouts/:id/exercises/order", workoutHandler.ReorderWorkoutExercises)
+	api.DELETE("/workouts/:id/exercises/:exercise_id", workoutHandler.RemoveExerciseFromWorkout)
+	api.POST("/workouts/:id/exercises/:exercise_id/substitute", workoutHandler.SubstituteExercise)
+	api.POST("/workouts/:id/groups", workoutHandler.GroupExercises)
+	api.DELETE("/workouts/:id/groups/:group_id", workoutHandler.UngroupExercises)
+	api.GET("/workouts/:id", workoutHandler.GetWorkoutDetails)
+	api.PUT("/workouts/:id", workoutHandler.UpdateWorkout)
+	api.PATCH("/workouts/:id", workoutHandler.UpdateWorkout)
+	api.DELETE("/workouts/:id", workoutHandler.DeleteWorkout)
+	api.POST("/workouts/:id/start", workoutHandler.StartWorkout)
+	api.POST("/workouts/:id/finish", workoutHandler.FinishWorkout)
+
+	// templates
+	api.POST("/templates", templateHandler.CreateTemplate)
+	api.GET("/templates", templateHandler.ListTemplates)
+	api.GET("/templates/:id", templateHandler.GetTemplateByID)
+	api.PUT("/templates/:id", templateHandler.UpdateTemplate)
+	api.PATCH("/templates/:id", templateHandler.UpdateTemplate)
+	api.DELETE("/templates/:id", templateHandler.DeleteTemplate)
+	api.POST("/templates/:id/instantiate", templateHandler.InstantiateTemplate)
 
 	// sets - exercise_id = workoutExerciseId
-	r.POST("/workouts/:id/exercises/:exercise_id/sets", setHandler.AddSetToExercise)
-	r.GET("/workouts/:id/exercises/:exercise_id/sets", setHandler.GetSetsForExercise)
+	api.POST("/workouts/:id/exercises/:exercise_id/sets", setHandler.AddSetToExercise)
+	api.GET("/workouts/:id/exercises/:exercise_id/sets", setHandler.GetSetsForExercise)
+	api.GET("/workouts/:id/exercises/:exercise_id/sets/:set_id", setHandler.GetSetByID)
+	api.PUT("/workouts/:id/exercises/:exercise_id/sets/:set_id", setHandler.UpdateSet)
+	api.PATCH("/workouts/:id/exercises/:exercise_id/sets/:set_id", setHandler.UpdateSet)
+	api.DELETE("/workouts/:id/exercises/:exercise_id/sets/:set_id", setHandler.DeleteSet)
 
 	r.Run()
 }
@@ -2,14 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strconv"
 	"testing"
+	"time"
+	"workout/analytics"
+	"workout/auth"
+	"workout/database"
+	"workout/database/migrations"
 	"workout/handlers"
 	"workout/models"
 	"workout/repo"
@@ -17,50 +24,40 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	. "github.com/smartystreets/goconvey/convey"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 var (
 	testDB              *gorm.DB
-	testUserRepo        *repo.UserRepository
+	testUserRepo        repo.UserRepository
 	testUserHandler     *handlers.UserHandler
-	testExerciseRepo    *repo.ExerciseRepository
+	testExerciseRepo    repo.ExerciseRepository
 	testExerciseHandler *handlers.ExerciseHandler
+	testAuthHandler     *handlers.AuthHandler
+	testWorkoutHandler  *handlers.WorkoutHandler
+	testSetHandler      *handlers.SetHandler
+	testTokens          = auth.NewTokenManager("test-secret", time.Minute, time.Hour)
 )
 
 func TestMain(m *testing.M) {
-	err := godotenv.Load()
+	// .env is optional here, the test database defaults to in-memory SQLite
+	godotenv.Load()
+
+	db, err := database.Open(database.ConfigFromEnv(true))
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		log.Fatalf("failed to connect to test database: %v", err)
 	}
-	var (
-		host     = os.Getenv("DB_HOST")
-		user     = os.Getenv("DB_USER")
-		password = os.Getenv("DB_PASSWORD")
-		dbname   = os.Getenv("DB_NAME_TEST")
-		port     = os.Getenv("DB_PORT")
-		sslmode  = os.Getenv("DB_SSLMODE")
-	)
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-		host, user, password, dbname, port, sslmode)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		panic("failed to connect to test database")
+	if _, err := migrations.Up(db); err != nil {
+		log.Fatalf("failed to migrate test database: %v", err)
 	}
-
 	testDB = db
-	testDB.AutoMigrate(&models.User{})
-	testDB.AutoMigrate(&models.Exercise{})
-	testDB.AutoMigrate(&models.Workout{})
-	testDB.AutoMigrate(&models.WorkoutExercise{})
-	testDB.AutoMigrate(&models.Set{})
 
 	code := m.Run()
 	os.Exit(code)
 }
 
-func setupTestDB(t *testing.T) (*gorm.DB, func()) {
+func setupTestDB(t testing.TB) (*gorm.DB, func()) {
 	tx := testDB.Begin()
 
 	if tx.Error != nil {
@@ -79,17 +76,131 @@ func setupRouter(db *gorm.DB) *gin.Engine {
 	testUserRepo = repo.NewUserRepository(db)
 	testUserHandler = handlers.NewUserHandler(testUserRepo)
 	testExerciseRepo = repo.NewExerciseRepository(db)
-	testExerciseHandler = handlers.NewExerciseHandler(testExerciseRepo)
+	testRecordRepo := repo.NewRecordRepository(db)
+	testExerciseHandler = handlers.NewExerciseHandler(testExerciseRepo, repo.NewTaxonomyRepository(db), testUserRepo, testRecordRepo)
+	testAuthHandler = handlers.NewAuthHandler(testUserRepo, testTokens)
+	testWorkoutRepo := repo.NewWorkoutRepository(db)
+	testWorkoutExerciseRepo := repo.NewWorkoutExerciseRepository(db)
+	testWorkoutHandler = handlers.NewWorkoutHandler(testWorkoutRepo, testExerciseRepo, testWorkoutExerciseRepo, testRecordRepo, testUserRepo)
+	testSetRepo := repo.NewSetRepository(db)
+	testSetHandler = handlers.NewSetHandler(testSetRepo, testWorkoutExerciseRepo, testRecordRepo, testExerciseRepo, testUserRepo)
+	testProgressHandler := handlers.NewProgressHandler(testSetRepo, testUserRepo)
+	testTemplateHandler := handlers.NewTemplateHandler(repo.NewTemplateRepository(db), testExerciseRepo, testWorkoutRepo, testUserRepo)
+	testRecordHandler := handlers.NewRecordHandler(testRecordRepo, testUserRepo)
 
 	// Define routes for testing
-	r.POST("/exercises", testExerciseHandler.CreateExercise)
-	r.GET("/exercises/:id", testExerciseHandler.GetExerciseByID)
-	r.PUT("/exercises/:id", testExerciseHandler.UpdateExercise)
-	r.DELETE("/exercises/:id", testExerciseHandler.DeleteExercise)
+	r.POST("/auth/register", testAuthHandler.Register)
+	r.POST("/auth/login", testAuthHandler.Login)
+	r.POST("/auth/refresh", testAuthHandler.Refresh)
+
+	api := r.Group("/", auth.Middleware(testTokens, testUserRepo))
+	api.GET("/users/:id", testUserHandler.GetUserByID)
+	api.PATCH("/users/:id", testUserHandler.UpdateUser)
+	api.DELETE("/users/:id", testUserHandler.DeleteUser)
+	api.GET("/users/:id/workouts", testWorkoutHandler.ListWorkouts)
+	api.GET("/users/:id/exercises/:exercise_id/records", testRecordHandler.GetRecordHistory)
+	api.GET("/users/:id/exercises/:exercise_id/progress", testProgressHandler.GetExerciseProgress)
+	api.GET("/exercises", testExerciseHandler.ListExercises)
+	api.GET("/muscle-groups", testExerciseHandler.ListMuscleGroups)
+	api.POST("/exercises", testExerciseHandler.CreateExercise)
+	api.GET("/exercises/search", testExerciseHandler.SearchExercises)
+	api.GET("/exercises/:id", testExerciseHandler.GetExerciseByID)
+	api.PUT("/exercises/:id", testExerciseHandler.UpdateExercise)
+	api.PATCH("/exercises/:id", testExerciseHandler.UpdateExercise)
+	api.DELETE("/exercises/:id", testExerciseHandler.DeleteExercise)
+	api.POST("/exercises/:id/merge", testExerciseHandler.MergeExercises)
+	api.POST("/templates", testTemplateHandler.CreateTemplate)
+	api.GET("/templates/:id", testTemplateHandler.GetTemplateByID)
+	api.PATCH("/templates/:id", testTemplateHandler.UpdateTemplate)
+	api.POST("/templates/:id/instantiate", testTemplateHandler.InstantiateTemplate)
+	api.POST("/workouts", testWorkoutHandler.CreateWorkout)
+	api.POST("/workouts/full", testWorkoutHandler.CreateFullWorkout)
+	api.POST("/workouts/:id/exercises", testWorkoutHandler.AddExerciseToWorkout)
+	api.PUT("/workouts/:id/exercises/order", testWorkoutHandler.ReorderWorkoutExercises)
+	api.DELETE("/workouts/:id/exercises/:exercise_id", testWorkoutHandler.RemoveExerciseFromWorkout)
+	api.POST("/workouts/:id/exercises/:exercise_id/substitute", testWorkoutHandler.SubstituteExercise)
+	api.POST("/workouts/:id/groups", testWorkoutHandler.GroupExercises)
+	api.DELETE("/workouts/:id/groups/:group_id", testWorkoutHandler.UngroupExercises)
+	api.GET("/workouts/:id", testWorkoutHandler.GetWorkoutDetails)
+	api.PUT("/workouts/:id", testWorkoutHandler.UpdateWorkout)
+	api.DELETE("/workouts/:id", testWorkoutHandler.DeleteWorkout)
+	api.POST("/workouts/:id/start", testWorkoutHandler.StartWorkout)
+	api.POST("/workouts/:id/finish", testWorkoutHandler.FinishWorkout)
+	api.POST("/workouts/:id/exercises/:exercise_id/sets", testSetHandler.AddSetToExercise)
+	api.GET("/workouts/:id/exercises/:exercise_id/sets", testSetHandler.GetSetsForExercise)
+	api.GET("/workouts/:id/exercises/:exercise_id/sets/:set_id", testSetHandler.GetSetByID)
+	api.PATCH("/workouts/:id/exercises/:exercise_id/sets/:set_id", testSetHandler.UpdateSet)
+	api.DELETE("/workouts/:id/exercises/:exercise_id/sets/:set_id", testSetHandler.DeleteSet)
 
 	return r
 }
 
+// createTestUser inserts a user and returns it along with a valid access token
+func createTestUser(t testing.TB, db *gorm.DB, username string) (models.User, string) {
+	user := models.User{Username: username}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	tokens, err := testTokens.IssueTokens(user.ID)
+	if err != nil {
+		t.Fatalf("failed to issue test tokens: %v", err)
+	}
+	return user, tokens.AccessToken
+}
+
+// serve sends a JSON request authenticated with token to r and records the response
+func serve(r http.Handler, token, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// queryCounter is a logger counting the SQL statements a session runs
+type queryCounter struct {
+	logger.Interface
+	queries int
+}
+
+func (q *queryCounter) LogMode(logger.LogLevel) logger.Interface { return q }
+
+func (q *queryCounter) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	q.queries++
+}
+
+// countQueries runs fn against a session of db that counts its statements
+func countQueries(db *gorm.DB, fn func(db *gorm.DB)) int {
+	counter := &queryCounter{Interface: logger.Discard}
+	fn(db.Session(&gorm.Session{Logger: counter}))
+	return counter.queries
+}
+
+// createLoggedWorkouts creates count workouts for the user, each with exercises exercises of sets sets
+func createLoggedWorkouts(t testing.TB, db *gorm.DB, userID uint, count, exercises, sets int) []uint {
+	exercise := models.Exercise{Name: "Squat", UserID: &userID}
+	if err := db.Where(&exercise).FirstOrCreate(&exercise).Error; err != nil {
+		t.Fatalf("failed to create exercise: %v", err)
+	}
+	var ids []uint
+	for i := 0; i < count; i++ {
+		workout := models.Workout{Name: "Legs", UserID: userID}
+		for j := 0; j < exercises; j++ {
+			we := models.WorkoutExercise{ExerciseID: exercise.ID}
+			for k := 1; k <= sets; k++ {
+				we.Sets = append(we.Sets, models.Set{SetNumber: k, Reps: 5, Weight: 100})
+			}
+			workout.Exercises = append(workout.Exercises, we)
+		}
+		if err := db.Create(&workout).Error; err != nil {
+			t.Fatalf("failed to create workout: %v", err)
+		}
+		ids = append(ids, workout.ID)
+	}
+	return ids
+}
+
 func TestCreateExercise(t *testing.T) {
 	Convey("Given a database and an exercise", t, func() {
 		db, cleanup := setupTestDB(t)
@@ -99,11 +210,13 @@ func TestCreateExercise(t *testing.T) {
 		}
 		w := httptest.NewRecorder()
 		r := setupRouter(db)
+		_, token := createTestUser(t, db, "tester")
 		Convey("When a create request is sent", func() {
 			Convey("And everything is given", func() {
 				body, _ := json.Marshal(exercise)
 				req, _ := http.NewRequest("POST", "/exercises", bytes.NewBuffer(body))
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+token)
 				Convey("Then the exercise is created", func() {
 					r.ServeHTTP(w, req)
 					var createdExercise models.Exercise
@@ -118,6 +231,7 @@ func TestCreateExercise(t *testing.T) {
 				body, _ := json.Marshal(exercise)
 				req, _ := http.NewRequest("POST", "/exercises", bytes.NewBuffer(body))
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+token)
 				Convey("Then an error is returned", func() {
 					r.ServeHTTP(w, req)
 					// Parse response
@@ -141,10 +255,12 @@ func TestGetExerciseByID(t *testing.T) {
 		db.Create(&testExercise)
 		w := httptest.NewRecorder()
 		r := setupRouter(db)
+		_, token := createTestUser(t, db, "tester")
 		Convey("When getting an exercise", func() {
 			Convey("And the ID exists", func() {
 				req, _ := http.NewRequest("GET", "/exercises/"+strconv.Itoa(int(testExercise.ID)), nil)
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+token)
 				Convey("Then the exercise is returned", func() {
 					r.ServeHTTP(w, req)
 					var fetchedExercise models.Exercise
@@ -157,6 +273,7 @@ func TestGetExerciseByID(t *testing.T) {
 			Convey("And the ID does not exist", func() {
 				req, _ := http.NewRequest("GET", "/exercises/10", nil)
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+token)
 				Convey("Then an error is returned", func() {
 					r.ServeHTTP(w, req)
 					// Parse response
@@ -174,31 +291,57 @@ func TestUpdateExercise(t *testing.T) {
 	Convey("Given a database and an exercise", t, func() {
 		db, cleanup := setupTestDB(t)
 		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
 		testExercise := models.Exercise{
-			Name: "Bench Press",
+			Name:   "Bench Press",
+			UserID: &user.ID,
 		}
 		db.Create(&testExercise)
 		w := httptest.NewRecorder()
 		r := setupRouter(db)
 		Convey("When updating an exercise", func() {
-			exercise := models.Exercise{
-				Name: "Squat",
+			name := "Squat"
+			exercise := models.ExercisePatch{
+				Name: &name,
 			}
 			body, _ := json.Marshal(exercise)
 			Convey("And the ID exists", func() {
 				req, _ := http.NewRequest("PUT", "/exercises/"+strconv.Itoa(int(testExercise.ID)), bytes.NewBuffer(body))
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+token)
 				Convey("Then the updated exercise is returned", func() {
 					r.ServeHTTP(w, req)
 					var updatedExercise models.Exercise
 					json.Unmarshal(w.Body.Bytes(), &updatedExercise)
 					So(w.Code, ShouldEqual, http.StatusOK)
-					So(updatedExercise.Name, ShouldEqual, exercise.Name)
+					So(updatedExercise.Name, ShouldEqual, name)
+				})
+			})
+			Convey("And protected or invalid fields are given", func() {
+				body, _ := json.Marshal(map[string]interface{}{"Name": "", "ID": 99, "DeletedAt": "2024-01-01T00:00:00Z"})
+				req, _ := http.NewRequest("PATCH", "/exercises/"+strconv.Itoa(int(testExercise.ID)), bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+token)
+				Convey("Then every rejected field is listed and nothing is updated", func() {
+					r.ServeHTTP(w, req)
+					var response struct {
+						Fields map[string]string `json:"fields"`
+					}
+					json.Unmarshal(w.Body.Bytes(), &response)
+					So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+					So(response.Fields, ShouldContainKey, "Name")
+					So(response.Fields, ShouldContainKey, "ID")
+					So(response.Fields, ShouldContainKey, "DeletedAt")
+
+					var stored models.Exercise
+					db.First(&stored, testExercise.ID)
+					So(stored.Name, ShouldEqual, "Bench Press")
 				})
 			})
 			Convey("And the ID does not exist", func() {
 				req, _ := http.NewRequest("PUT", "/exercises/10", bytes.NewBuffer(body))
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+token)
 				Convey("Then an error is returned", func() {
 					r.ServeHTTP(w, req)
 					// Parse response
@@ -216,8 +359,10 @@ func TestDeleteExercise(t *testing.T) {
 	Convey("Given a database and an exercise", t, func() {
 		db, cleanup := setupTestDB(t)
 		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
 		testExercise := models.Exercise{
-			Name: "Bench Press",
+			Name:   "Bench Press",
+			UserID: &user.ID,
 		}
 		db.Create(&testExercise)
 		w := httptest.NewRecorder()
@@ -226,6 +371,7 @@ func TestDeleteExercise(t *testing.T) {
 			Convey("And the ID exists", func() {
 				req, _ := http.NewRequest("DELETE", "/exercises/"+strconv.Itoa(int(testExercise.ID)), nil)
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+token)
 				Convey("Then the exercise is deleted", func() {
 					r.ServeHTTP(w, req)
 					var response map[string]string
@@ -237,6 +383,7 @@ func TestDeleteExercise(t *testing.T) {
 			Convey("And an invalid ID is provided", func() {
 				req, _ := http.NewRequest("DELETE", "/exercises/invalid", nil)
 				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+token)
 				Convey("Then an error is returned", func() {
 					r.ServeHTTP(w, req)
 					var response map[string]string
@@ -248,3 +395,1954 @@ func TestDeleteExercise(t *testing.T) {
 		})
 	})
 }
+
+func TestExerciseScopes(t *testing.T) {
+	Convey("Given a database with a global exercise and a custom exercise of another user", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		admin, adminToken := createTestUser(t, db, "admin")
+		db.Model(&admin).Update("is_admin", true)
+		other, _ := createTestUser(t, db, "other")
+		_, token := createTestUser(t, db, "tester")
+		global := models.Exercise{Name: "Bench Press"}
+		db.Create(&global)
+		custom := models.Exercise{Name: "Zercher Squat", UserID: &other.ID}
+		db.Create(&custom)
+		r := setupRouter(db)
+		globalPath := "/exercises/" + strconv.Itoa(int(global.ID))
+		Convey("When a user lists the exercises", func() {
+			w := serve(r, token, "GET", "/exercises", "")
+			Convey("Then the other user's custom exercise is not listed", func() {
+				var page models.Page[models.Exercise]
+				json.Unmarshal(w.Body.Bytes(), &page)
+				So(len(page.Items), ShouldEqual, 1)
+				So(page.Items[0].Name, ShouldEqual, "Bench Press")
+				So(serve(r, token, "GET", "/exercises/"+strconv.Itoa(int(custom.ID)), "").Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+		Convey("When a user changes or deletes the global exercise", func() {
+			Convey("Then it is forbidden", func() {
+				So(serve(r, token, "PATCH", globalPath, `{"Name": "Flat Bench"}`).Code, ShouldEqual, http.StatusForbidden)
+				So(serve(r, token, "DELETE", globalPath, "").Code, ShouldEqual, http.StatusForbidden)
+				So(serve(r, token, "POST", "/exercises?scope=global", `{"Name": "Deadlift"}`).Code, ShouldEqual, http.StatusForbidden)
+			})
+		})
+		Convey("When an admin adds to the global catalog", func() {
+			w := serve(r, adminToken, "POST", "/exercises?scope=global", `{"Name": "Deadlift"}`)
+			Convey("Then the exercise has no owner", func() {
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				var exercise models.Exercise
+				json.Unmarshal(w.Body.Bytes(), &exercise)
+				So(exercise.UserID, ShouldBeNil)
+			})
+		})
+		Convey("When a name is reused in a different case", func() {
+			Convey("Then it conflicts within the same scope only", func() {
+				So(serve(r, adminToken, "POST", "/exercises?scope=global", `{"Name": "bench press"}`).Code, ShouldEqual, http.StatusConflict)
+				So(serve(r, token, "POST", "/exercises", `{"Name": "BENCH PRESS"}`).Code, ShouldEqual, http.StatusCreated)
+				So(serve(r, token, "POST", "/exercises", `{"Name": "zercher squat"}`).Code, ShouldEqual, http.StatusCreated)
+				So(serve(r, token, "POST", "/exercises", `{"Name": "Zercher Squat"}`).Code, ShouldEqual, http.StatusConflict)
+			})
+		})
+		Convey("When the admin deletes the global exercise while a workout uses it", func() {
+			workout := models.Workout{Name: "Push", UserID: other.ID}
+			db.Create(&workout)
+			db.Create(&models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: global.ID})
+			w := serve(r, adminToken, "DELETE", globalPath, "")
+			Convey("Then it is blocked", func() {
+				So(w.Code, ShouldEqual, http.StatusConflict)
+				var stored models.Exercise
+				So(db.First(&stored, global.ID).Error, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestMergeExercises(t *testing.T) {
+	Convey("Given a user who logged a duplicate of an exercise", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		target := models.Exercise{Name: "Back Squat", UserID: &user.ID}
+		db.Create(&target)
+		duplicate := models.Exercise{Name: "Squat (Barbell)", UserID: &user.ID}
+		db.Create(&duplicate)
+		global := models.Exercise{Name: "Squat"}
+		db.Create(&global)
+		workout := models.Workout{Name: "Legs", UserID: user.ID}
+		db.Create(&workout)
+		workoutExercise := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: duplicate.ID}
+		db.Create(&workoutExercise)
+		template := models.WorkoutTemplate{Name: "Legs", UserID: user.ID, Exercises: []models.TemplateExercise{{ExerciseID: duplicate.ID, Position: 1}}}
+		db.Create(&template)
+		r := setupRouter(db)
+		serve(r, token, "POST", "/workouts/"+strconv.Itoa(int(workout.ID))+"/exercises/"+strconv.Itoa(int(workoutExercise.ID))+"/sets", `{"SetNumber": 1, "Reps": 5, "Weight": 100}`)
+		mergePath := "/exercises/" + strconv.Itoa(int(target.ID)) + "/merge"
+		Convey("When the duplicate is merged into the exercise", func() {
+			w := serve(r, token, "POST", mergePath, `{"SourceIDs": [`+strconv.Itoa(int(duplicate.ID))+`]}`)
+			Convey("Then workouts, templates and records point at the exercise", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				var moved models.WorkoutExercise
+				db.First(&moved, workoutExercise.ID)
+				So(moved.ExerciseID, ShouldEqual, target.ID)
+				var planned models.TemplateExercise
+				db.Where("template_id = ?", template.ID).First(&planned)
+				So(planned.ExerciseID, ShouldEqual, target.ID)
+				var records, stale int64
+				db.Model(&models.PersonalRecord{}).Where("exercise_id = ?", target.ID).Count(&records)
+				db.Model(&models.PersonalRecord{}).Where("exercise_id = ?", duplicate.ID).Count(&stale)
+				So(records, ShouldBeGreaterThan, 0)
+				So(stale, ShouldEqual, 0)
+			})
+			Convey("Then the duplicate is gone and its name still finds the exercise", func() {
+				So(serve(r, token, "GET", "/exercises/"+strconv.Itoa(int(duplicate.ID)), "").Code, ShouldEqual, http.StatusNotFound)
+				var page models.Page[models.Exercise]
+				json.Unmarshal(serve(r, token, "GET", "/exercises?name_prefix=squat%20(b", "").Body.Bytes(), &page)
+				So(len(page.Items), ShouldEqual, 1)
+				So(page.Items[0].ID, ShouldEqual, target.ID)
+				So(page.Items[0].Aliases[0].Name, ShouldEqual, "Squat (Barbell)")
+			})
+		})
+		Convey("When an exercise is merged into itself", func() {
+			w := serve(r, token, "POST", mergePath, `{"SourceIDs": [`+strconv.Itoa(int(target.ID))+`]}`)
+			Convey("Then it is rejected", func() {
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+		Convey("When a user merges a global exercise", func() {
+			w := serve(r, token, "POST", mergePath, `{"SourceIDs": [`+strconv.Itoa(int(global.ID))+`]}`)
+			Convey("Then it is forbidden", func() {
+				So(w.Code, ShouldEqual, http.StatusForbidden)
+			})
+		})
+	})
+}
+
+func TestExerciseSearch(t *testing.T) {
+	Convey("Given a catalog and a user who often does one of its exercises", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		exercises := map[string]*models.Exercise{}
+		for _, name := range []string{"Overhead Press", "Bench Press", "Incline Bench Press", "Squat", "Dumbbell Row"} {
+			exercise := models.Exercise{Name: name}
+			db.Create(&exercise)
+			exercises[name] = &exercise
+		}
+		db.Create(&models.ExerciseAlias{ExerciseID: exercises["Overhead Press"].ID, Name: "Military Press"})
+		for i := 0; i < 2; i++ {
+			workout := models.Workout{Name: "Push", UserID: user.ID}
+			db.Create(&workout)
+			db.Create(&models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: exercises["Incline Bench Press"].ID})
+		}
+		r := setupRouter(db)
+		find := func(query string) ([]models.ExerciseMatch, int) {
+			w := serve(r, token, "GET", "/exercises/search?q="+url.QueryEscape(query), "")
+			var matches []models.ExerciseMatch
+			json.Unmarshal(w.Body.Bytes(), &matches)
+			return matches, w.Code
+		}
+		Convey("When searching with a typo", func() {
+			matches, code := find("bnech")
+			Convey("Then the exercise the user does most comes first", func() {
+				So(code, ShouldEqual, http.StatusOK)
+				So(len(matches), ShouldEqual, 2)
+				So(matches[0].Name, ShouldEqual, "Incline Bench Press")
+				So(matches[0].Uses, ShouldEqual, 2)
+				So(matches[1].Name, ShouldEqual, "Bench Press")
+			})
+		})
+		Convey("When searching for the full name", func() {
+			matches, _ := find("bench press")
+			Convey("Then the exact match comes first", func() {
+				So(matches[0].Name, ShouldEqual, "Bench Press")
+				So(matches[0].Score, ShouldEqual, 1)
+			})
+		})
+		Convey("When searching by abbreviation or alias", func() {
+			ohp, _ := find("OHP")
+			military, _ := find("milit")
+			row, _ := find("db row")
+			Convey("Then the exercise is found under its name", func() {
+				So(ohp[0].Name, ShouldEqual, "Overhead Press")
+				So(military[0].Name, ShouldEqual, "Overhead Press")
+				So(military[0].MatchedName, ShouldEqual, "Military Press")
+				So(row[0].Name, ShouldEqual, "Dumbbell Row")
+			})
+		})
+		Convey("When nothing matches", func() {
+			matches, code := find("zzz")
+			Convey("Then the result is empty", func() {
+				So(code, ShouldEqual, http.StatusOK)
+				So(matches, ShouldBeEmpty)
+			})
+		})
+		Convey("When the query is empty", func() {
+			_, code := find(" ")
+			Convey("Then it is rejected", func() {
+				So(code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestRegister(t *testing.T) {
+	Convey("Given a database", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		w := httptest.NewRecorder()
+		r := setupRouter(db)
+		Convey("When a register request is sent", func() {
+			Convey("And everything is given", func() {
+				body, _ := json.Marshal(handlers.RegisterRequest{Username: "lifter", Name: "Lifter", Password: "squat-1234"})
+				req, _ := http.NewRequest("POST", "/auth/register", bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				Convey("Then the user is created with a hashed password and tokens are returned", func() {
+					r.ServeHTTP(w, req)
+					var response struct {
+						User   map[string]interface{} `json:"user"`
+						Tokens auth.TokenPair         `json:"tokens"`
+					}
+					json.Unmarshal(w.Body.Bytes(), &response)
+					So(w.Code, ShouldEqual, http.StatusCreated)
+					So(response.User["Username"], ShouldEqual, "lifter")
+					So(response.User, ShouldNotContainKey, "PasswordHash")
+					So(response.Tokens.AccessToken, ShouldNotBeEmpty)
+					So(response.Tokens.RefreshToken, ShouldNotBeEmpty)
+
+					var stored models.User
+					db.Where("username = ?", "lifter").First(&stored)
+					So(stored.PasswordHash, ShouldNotEqual, "squat-1234")
+					So(auth.CheckPassword(stored.PasswordHash, "squat-1234"), ShouldBeTrue)
+				})
+			})
+			Convey("And the username is taken", func() {
+				createTestUser(t, db, "lifter")
+				body, _ := json.Marshal(handlers.RegisterRequest{Username: "lifter", Password: "squat-1234"})
+				req, _ := http.NewRequest("POST", "/auth/register", bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				Convey("Then a conflict is returned", func() {
+					r.ServeHTTP(w, req)
+					So(w.Code, ShouldEqual, http.StatusConflict)
+				})
+			})
+			Convey("And the password is too short", func() {
+				body, _ := json.Marshal(handlers.RegisterRequest{Username: "lifter", Password: "short"})
+				req, _ := http.NewRequest("POST", "/auth/register", bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				Convey("Then an error is returned", func() {
+					r.ServeHTTP(w, req)
+					So(w.Code, ShouldEqual, http.StatusBadRequest)
+				})
+			})
+		})
+	})
+}
+
+func TestLogin(t *testing.T) {
+	Convey("Given a database and a registered user", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		hash, _ := auth.HashPassword("squat-1234")
+		user := models.User{Username: "lifter", PasswordHash: hash}
+		db.Create(&user)
+		w := httptest.NewRecorder()
+		r := setupRouter(db)
+		Convey("When logging in", func() {
+			Convey("And the password is correct", func() {
+				body, _ := json.Marshal(handlers.LoginRequest{Username: "lifter", Password: "squat-1234"})
+				req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				Convey("Then the access token can be used on protected routes", func() {
+					r.ServeHTTP(w, req)
+					So(w.Code, ShouldEqual, http.StatusOK)
+					var tokens auth.TokenPair
+					json.Unmarshal(w.Body.Bytes(), &tokens)
+
+					w = httptest.NewRecorder()
+					req, _ = http.NewRequest("GET", "/users/"+strconv.Itoa(int(user.ID)), nil)
+					req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+					r.ServeHTTP(w, req)
+					So(w.Code, ShouldEqual, http.StatusOK)
+				})
+				Convey("Then the refresh token cannot be used as an access token", func() {
+					r.ServeHTTP(w, req)
+					var tokens auth.TokenPair
+					json.Unmarshal(w.Body.Bytes(), &tokens)
+
+					w = httptest.NewRecorder()
+					req, _ = http.NewRequest("GET", "/users/"+strconv.Itoa(int(user.ID)), nil)
+					req.Header.Set("Authorization", "Bearer "+tokens.RefreshToken)
+					r.ServeHTTP(w, req)
+					So(w.Code, ShouldEqual, http.StatusUnauthorized)
+				})
+			})
+			Convey("And the password is wrong", func() {
+				body, _ := json.Marshal(handlers.LoginRequest{Username: "lifter", Password: "bench-1234"})
+				req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+				req.Header.Set("Content-Type", "application/json")
+				Convey("Then an error is returned", func() {
+					r.ServeHTTP(w, req)
+					var response map[string]string
+					err := json.Unmarshal(w.Body.Bytes(), &response)
+					So(err, ShouldBeNil)
+					So(w.Code, ShouldEqual, http.StatusUnauthorized)
+					So(response["error"], ShouldEqual, "invalid username or password")
+				})
+			})
+		})
+		Convey("When a protected route is requested without a token", func() {
+			req, _ := http.NewRequest("GET", "/users/"+strconv.Itoa(int(user.ID)), nil)
+			Convey("Then the request is rejected", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+	})
+}
+
+func TestWorkoutOwnership(t *testing.T) {
+	Convey("Given a database and a workout belonging to another user", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		owner, _ := createTestUser(t, db, "owner")
+		intruder, token := createTestUser(t, db, "intruder")
+		exercise := models.Exercise{Name: "Bench Press"}
+		db.Create(&exercise)
+		workout := models.Workout{Name: "Push", UserID: owner.ID}
+		db.Create(&workout)
+		workoutExercise := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: exercise.ID}
+		db.Create(&workoutExercise)
+		set := models.Set{WorkoutExerciseID: workoutExercise.ID, SetNumber: 1, Reps: 5, Weight: 100}
+		db.Create(&set)
+		workoutPath := "/workouts/" + strconv.Itoa(int(workout.ID))
+		w := httptest.NewRecorder()
+		r := setupRouter(db)
+		post := func(path, body string) {
+			w = serve(r, token, "POST", path, body)
+		}
+		Convey("When the other user creates a workout naming the owner's workout exercise", func() {
+			post("/workouts", `{"Name": "Mine", "Exercises": [{"ID": `+strconv.Itoa(int(workoutExercise.ID))+`}]}`)
+			Convey("Then only the workout is created and the workout exercise stays with the owner", func() {
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				var stored models.WorkoutExercise
+				db.First(&stored, workoutExercise.ID)
+				So(stored.WorkoutID, ShouldEqual, workout.ID)
+			})
+		})
+		Convey("When the other user adds an exercise to their workout naming the owner's set", func() {
+			mine := models.Workout{Name: "Mine", UserID: intruder.ID}
+			db.Create(&mine)
+			post("/workouts/"+strconv.Itoa(int(mine.ID))+"/exercises",
+				`{"ExerciseID": `+strconv.Itoa(int(exercise.ID))+`, "Sets": [{"ID": `+strconv.Itoa(int(set.ID))+`}, {"Type": "bogus", "Reps": -3}]}`)
+			Convey("Then only the exercise is added and the set stays with the owner", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				var stored models.Set
+				db.First(&stored, set.ID)
+				So(stored.WorkoutExerciseID, ShouldEqual, workoutExercise.ID)
+				var bogus int64
+				db.Model(&models.Set{}).Where("type = ?", "bogus").Count(&bogus)
+				So(bogus, ShouldEqual, 0)
+			})
+		})
+		Convey("When the other user requests the workout details", func() {
+			req, _ := http.NewRequest("GET", workoutPath, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then it is not found", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+		Convey("When the other user deletes the workout", func() {
+			req, _ := http.NewRequest("DELETE", workoutPath, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then it is not found and the workout still exists", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusNotFound)
+				var count int64
+				db.Model(&models.Workout{}).Where("id = ?", workout.ID).Count(&count)
+				So(count, ShouldEqual, 1)
+			})
+		})
+		Convey("When the other user adds a set to the workout", func() {
+			body, _ := json.Marshal(models.Set{SetNumber: 1, Reps: 5, Weight: 100})
+			req, _ := http.NewRequest("POST", workoutPath+"/exercises/"+strconv.Itoa(int(workoutExercise.ID))+"/sets", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then it is not found", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestAddSetToExercise(t *testing.T) {
+	Convey("Given a database and two workouts of the same user", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		exercise := models.Exercise{Name: "Bench Press"}
+		db.Create(&exercise)
+		workout := models.Workout{Name: "Push", UserID: user.ID}
+		db.Create(&workout)
+		otherWorkout := models.Workout{Name: "Pull", UserID: user.ID}
+		db.Create(&otherWorkout)
+		workoutExercise := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: exercise.ID}
+		db.Create(&workoutExercise)
+		body, _ := json.Marshal(models.Set{SetNumber: 1, Reps: 5, Weight: 100})
+		w := httptest.NewRecorder()
+		r := setupRouter(db)
+		Convey("When adding a set through the workout it belongs to", func() {
+			req, _ := http.NewRequest("POST", "/workouts/"+strconv.Itoa(int(workout.ID))+"/exercises/"+strconv.Itoa(int(workoutExercise.ID))+"/sets", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then the set is created", func() {
+				r.ServeHTTP(w, req)
+				var set models.Set
+				json.Unmarshal(w.Body.Bytes(), &set)
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				So(set.WorkoutExerciseID, ShouldEqual, workoutExercise.ID)
+			})
+		})
+		Convey("When adding a set that skips a number", func() {
+			body, _ := json.Marshal(models.Set{SetNumber: 7, Reps: 5, Weight: 100})
+			req, _ := http.NewRequest("POST", "/workouts/"+strconv.Itoa(int(workout.ID))+"/exercises/"+strconv.Itoa(int(workoutExercise.ID))+"/sets", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then it is rejected", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+		Convey("When adding a set without a number", func() {
+			db.Create(&models.Set{WorkoutExerciseID: workoutExercise.ID, SetNumber: 1, Reps: 5, Weight: 100})
+			body, _ := json.Marshal(models.Set{Reps: 5, Weight: 100})
+			req, _ := http.NewRequest("POST", "/workouts/"+strconv.Itoa(int(workout.ID))+"/exercises/"+strconv.Itoa(int(workoutExercise.ID))+"/sets", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then it is numbered after the last set", func() {
+				r.ServeHTTP(w, req)
+				var set models.Set
+				json.Unmarshal(w.Body.Bytes(), &set)
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				So(set.SetNumber, ShouldEqual, 2)
+			})
+		})
+		Convey("When adding a set through a different workout", func() {
+			req, _ := http.NewRequest("POST", "/workouts/"+strconv.Itoa(int(otherWorkout.ID))+"/exercises/"+strconv.Itoa(int(workoutExercise.ID))+"/sets", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then it is not found", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestDeleteSet(t *testing.T) {
+	Convey("Given a database and an exercise with three sets", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		exercise := models.Exercise{Name: "Bench Press"}
+		db.Create(&exercise)
+		workout := models.Workout{Name: "Push", UserID: user.ID}
+		db.Create(&workout)
+		workoutExercise := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: exercise.ID}
+		db.Create(&workoutExercise)
+		sets := []models.Set{
+			{WorkoutExerciseID: workoutExercise.ID, SetNumber: 1, Reps: 5, Weight: 100},
+			{WorkoutExerciseID: workoutExercise.ID, SetNumber: 2, Reps: 5, Weight: 100},
+			{WorkoutExerciseID: workoutExercise.ID, SetNumber: 3, Reps: 5, Weight: 100},
+		}
+		db.Create(&sets)
+		setsPath := "/workouts/" + strconv.Itoa(int(workout.ID)) + "/exercises/" + strconv.Itoa(int(workoutExercise.ID)) + "/sets/"
+		w := httptest.NewRecorder()
+		r := setupRouter(db)
+		Convey("When deleting the middle set", func() {
+			req, _ := http.NewRequest("DELETE", setsPath+strconv.Itoa(int(sets[1].ID)), nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then the remaining sets are renumbered", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				var remaining models.Set
+				db.First(&remaining, sets[2].ID)
+				So(remaining.SetNumber, ShouldEqual, 2)
+			})
+		})
+		Convey("When the set belongs to a different workout exercise", func() {
+			other := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: exercise.ID}
+			db.Create(&other)
+			req, _ := http.NewRequest("DELETE", "/workouts/"+strconv.Itoa(int(workout.ID))+"/exercises/"+strconv.Itoa(int(other.ID))+"/sets/"+strconv.Itoa(int(sets[0].ID)), nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then it is not found", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+		Convey("When moving the first set to the end", func() {
+			body, _ := json.Marshal(map[string]interface{}{"SetNumber": 3})
+			req, _ := http.NewRequest("PATCH", setsPath+strconv.Itoa(int(sets[0].ID)), bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then the sets after it move up", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				numbers := []int{}
+				for _, set := range sets {
+					var stored models.Set
+					db.First(&stored, set.ID)
+					numbers = append(numbers, stored.SetNumber)
+				}
+				So(numbers, ShouldResemble, []int{3, 1, 2})
+			})
+		})
+		Convey("When moving the last set to the front", func() {
+			body, _ := json.Marshal(map[string]interface{}{"SetNumber": 1})
+			req, _ := http.NewRequest("PATCH", setsPath+strconv.Itoa(int(sets[2].ID)), bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then the sets before it move down", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				numbers := []int{}
+				for _, set := range sets {
+					var stored models.Set
+					db.First(&stored, set.ID)
+					numbers = append(numbers, stored.SetNumber)
+				}
+				So(numbers, ShouldResemble, []int{2, 3, 1})
+			})
+		})
+		Convey("When moving a set past the last one", func() {
+			body, _ := json.Marshal(map[string]interface{}{"SetNumber": 4})
+			req, _ := http.NewRequest("PATCH", setsPath+strconv.Itoa(int(sets[0].ID)), bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then an error is returned", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+		Convey("When updating the reps of a set", func() {
+			body, _ := json.Marshal(map[string]interface{}{"Reps": 8})
+			req, _ := http.NewRequest("PATCH", setsPath+strconv.Itoa(int(sets[0].ID)), bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then the updated set is returned", func() {
+				r.ServeHTTP(w, req)
+				var set models.Set
+				json.Unmarshal(w.Body.Bytes(), &set)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(set.Reps, ShouldEqual, 8)
+			})
+		})
+		Convey("When updating the weight of a set to 0", func() {
+			body, _ := json.Marshal(map[string]interface{}{"Weight": 0})
+			req, _ := http.NewRequest("PATCH", setsPath+strconv.Itoa(int(sets[0].ID)), bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then it is stored like a bodyweight set logged with 0", func() {
+				r.ServeHTTP(w, req)
+				var set models.Set
+				json.Unmarshal(w.Body.Bytes(), &set)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(set.Weight, ShouldEqual, 0)
+			})
+		})
+		Convey("When updating the weight of a set to a negative one", func() {
+			body, _ := json.Marshal(map[string]interface{}{"Weight": -5})
+			req, _ := http.NewRequest("PATCH", setsPath+strconv.Itoa(int(sets[0].ID)), bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then it is rejected", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+	})
+}
+
+func TestListWorkouts(t *testing.T) {
+	Convey("Given a database and a user with three workouts", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		other, _ := createTestUser(t, db, "other")
+		for _, name := range []string{"Push A", "Pull A", "Push B"} {
+			db.Create(&models.Workout{Name: name, UserID: user.ID})
+		}
+		db.Create(&models.Workout{Name: "Push C", UserID: other.ID})
+		listPath := "/users/" + strconv.Itoa(int(user.ID)) + "/workouts"
+		r := setupRouter(db)
+		list := func(query string) (int, models.Page[models.Workout]) {
+			w := serve(r, token, "GET", listPath+query, "")
+			var page models.Page[models.Workout]
+			json.Unmarshal(w.Body.Bytes(), &page)
+			return w.Code, page
+		}
+		Convey("When listing page by page sorted by name", func() {
+			code, first := list("?sort=name&limit=2")
+			Convey("Then every workout of the user is returned exactly once in order", func() {
+				So(code, ShouldEqual, http.StatusOK)
+				So(len(first.Items), ShouldEqual, 2)
+				So(first.NextCursor, ShouldNotBeEmpty)
+
+				code, second := list("?sort=name&limit=2&cursor=" + first.NextCursor)
+				So(code, ShouldEqual, http.StatusOK)
+				So(len(second.Items), ShouldEqual, 1)
+				So(second.NextCursor, ShouldBeEmpty)
+				So([]string{first.Items[0].Name, first.Items[1].Name, second.Items[0].Name}, ShouldResemble, []string{"Pull A", "Push A", "Push B"})
+			})
+		})
+		Convey("When listing one workout per page by date", func() {
+			seen := map[uint]bool{}
+			cursor := ""
+			for i := 0; i < 3; i++ {
+				_, page := list("?limit=1&cursor=" + cursor)
+				for _, workout := range page.Items {
+					seen[workout.ID] = true
+				}
+				cursor = page.NextCursor
+			}
+			Convey("Then all workouts are visited and the last page has no cursor", func() {
+				So(len(seen), ShouldEqual, 3)
+				So(cursor, ShouldBeEmpty)
+			})
+		})
+		Convey("When filtering by name prefix", func() {
+			_, page := list("?name_prefix=push")
+			Convey("Then only matching workouts are returned", func() {
+				So(len(page.Items), ShouldEqual, 2)
+			})
+		})
+		Convey("When an unknown sort key is given", func() {
+			code, _ := list("?sort=reps")
+			Convey("Then an error is returned", func() {
+				So(code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+		Convey("When listing another user's workouts", func() {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/users/"+strconv.Itoa(int(other.ID))+"/workouts", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then the request is forbidden", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusForbidden)
+			})
+		})
+	})
+}
+
+func TestWorkoutTiming(t *testing.T) {
+	Convey("Given a database and a user", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		w := httptest.NewRecorder()
+		r := setupRouter(db)
+		Convey("When a workout is back-logged for yesterday", func() {
+			yesterday := time.Now().AddDate(0, 0, -1).Truncate(time.Second)
+			body, _ := json.Marshal(map[string]interface{}{"Name": "Legs", "PerformedAt": yesterday})
+			req, _ := http.NewRequest("POST", "/workouts", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			Convey("Then it is stored and listed with the performed date", func() {
+				r.ServeHTTP(w, req)
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				var created models.Workout
+				json.Unmarshal(w.Body.Bytes(), &created)
+				So(created.PerformedAt.Equal(yesterday), ShouldBeTrue)
+				So(created.UserID, ShouldEqual, user.ID)
+
+				w = httptest.NewRecorder()
+				today := time.Now().Format(time.DateOnly)
+				req, _ = http.NewRequest("GET", "/users/"+strconv.Itoa(int(user.ID))+"/workouts?from="+today, nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				r.ServeHTTP(w, req)
+				var page models.Page[models.Workout]
+				json.Unmarshal(w.Body.Bytes(), &page)
+				So(page.Items, ShouldBeEmpty)
+			})
+		})
+		Convey("When a workout is started and finished", func() {
+			workout := models.Workout{Name: "Legs", UserID: user.ID, PerformedAt: time.Now()}
+			db.Create(&workout)
+			workoutPath := "/workouts/" + strconv.Itoa(int(workout.ID))
+			send := func(action string) *httptest.ResponseRecorder {
+				return serve(r, token, "POST", workoutPath+"/"+action, "")
+			}
+			Convey("Then the duration is computed", func() {
+				So(send("start").Code, ShouldEqual, http.StatusOK)
+				finished := send("finish")
+				So(finished.Code, ShouldEqual, http.StatusOK)
+				var response map[string]interface{}
+				json.Unmarshal(finished.Body.Bytes(), &response)
+				So(response["StartedAt"], ShouldNotBeNil)
+				So(response["FinishedAt"], ShouldNotBeNil)
+				So(response["DurationSeconds"], ShouldNotBeNil)
+			})
+			Convey("Then finishing before starting is rejected", func() {
+				So(send("finish").Code, ShouldEqual, http.StatusConflict)
+			})
+		})
+	})
+}
+
+func TestPersonalRecords(t *testing.T) {
+	Convey("Given a database and a workout with a logged set", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		exercise := models.Exercise{Name: "Squat"}
+		db.Create(&exercise)
+		workout := models.Workout{Name: "Legs", UserID: user.ID}
+		db.Create(&workout)
+		workoutExercise := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: exercise.ID}
+		db.Create(&workoutExercise)
+		setsPath := "/workouts/" + strconv.Itoa(int(workout.ID)) + "/exercises/" + strconv.Itoa(int(workoutExercise.ID)) + "/sets"
+		r := setupRouter(db)
+		addSet := func(set models.Set) models.Set {
+			body, _ := json.Marshal(set)
+			w := serve(r, token, "POST", setsPath, string(body))
+			var created models.Set
+			json.Unmarshal(w.Body.Bytes(), &created)
+			return created
+		}
+		addSet(models.Set{SetNumber: 1, Reps: 5, Weight: 100})
+		Convey("When a heavier single is logged", func() {
+			set := addSet(models.Set{SetNumber: 2, Reps: 1, Weight: 110})
+			Convey("Then only the records it beats are reported", func() {
+				types := []string{}
+				for _, record := range set.Records {
+					types = append(types, record.Type)
+				}
+				So(types, ShouldContain, string(analytics.HeaviestWeight))
+				So(types, ShouldContain, string(analytics.MostRepsAtWeight))
+				So(types, ShouldNotContain, string(analytics.BestE1RM))
+				So(types, ShouldNotContain, string(analytics.BestSetVolume))
+			})
+			Convey("Then the record history lists both sets", func() {
+				w := serve(r, token, "GET", "/users/"+strconv.Itoa(int(user.ID))+"/exercises/"+strconv.Itoa(int(exercise.ID))+"/records?type=heaviest_weight", "")
+				var records []models.PersonalRecord
+				json.Unmarshal(w.Body.Bytes(), &records)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(len(records), ShouldEqual, 2)
+				So(records[0].Value, ShouldEqual, 100)
+				So(records[1].Value, ShouldEqual, 110)
+			})
+		})
+		Convey("When the same set is repeated", func() {
+			set := addSet(models.Set{SetNumber: 2, Reps: 5, Weight: 100})
+			Convey("Then no record is reported", func() {
+				So(set.Records, ShouldBeEmpty)
+			})
+		})
+		Convey("When a set of ten and a heavier triple are logged", func() {
+			addSet(models.Set{SetNumber: 2, Reps: 10, Weight: 100})
+			addSet(models.Set{SetNumber: 3, Reps: 3, Weight: 125})
+			bestE1RM := func(formula string) (int, []models.PersonalRecord) {
+				w := serve(r, token, "GET", "/users/"+strconv.Itoa(int(user.ID))+"/exercises/"+strconv.Itoa(int(exercise.ID))+"/records?type=best_e1rm&formula="+formula, "")
+				var records []models.PersonalRecord
+				json.Unmarshal(w.Body.Bytes(), &records)
+				return w.Code, records
+			}
+			Convey("Then Epley counts the triple as a best e1RM", func() {
+				code, records := bestE1RM("epley")
+				So(code, ShouldEqual, http.StatusOK)
+				So(len(records), ShouldEqual, 3)
+				So(records[2].Value, ShouldAlmostEqual, 137.5, 0.01)
+			})
+			Convey("Then Brzycki, which estimates the triple lower, does not", func() {
+				code, records := bestE1RM("brzycki")
+				So(code, ShouldEqual, http.StatusOK)
+				So(len(records), ShouldEqual, 2)
+				So(records[0].Value, ShouldAlmostEqual, 112.5, 0.01)
+				So(records[1].Value, ShouldAlmostEqual, 133.33, 0.01)
+			})
+			Convey("Then an unknown formula is rejected", func() {
+				code, _ := bestE1RM("lombardi")
+				So(code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestExerciseProgress(t *testing.T) {
+	Convey("Given a database and two squat sessions in different weeks", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		exercise := models.Exercise{Name: "Squat"}
+		db.Create(&exercise)
+		monday := time.Date(2024, time.March, 4, 18, 0, 0, 0, time.Local)
+		for i, weight := range []float64{100, 105} {
+			workout := models.Workout{Name: "Legs", UserID: user.ID, PerformedAt: monday.AddDate(0, 0, 7*i)}
+			db.Create(&workout)
+			workoutExercise := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: exercise.ID}
+			db.Create(&workoutExercise)
+			db.Create(&[]models.Set{
+				{WorkoutExerciseID: workoutExercise.ID, SetNumber: 1, Reps: 5, Weight: weight},
+				{WorkoutExerciseID: workoutExercise.ID, SetNumber: 2, Reps: 3, Weight: weight - 10},
+			})
+		}
+		progressPath := "/users/" + strconv.Itoa(int(user.ID)) + "/exercises/" + strconv.Itoa(int(exercise.ID)) + "/progress"
+		r := setupRouter(db)
+		progress := func(query string) (int, []analytics.ProgressPoint) {
+			w := serve(r, token, "GET", progressPath+query, "")
+			var series []analytics.ProgressPoint
+			json.Unmarshal(w.Body.Bytes(), &series)
+			return w.Code, series
+		}
+		Convey("When the progress is bucketed by week", func() {
+			code, series := progress("?bucket=week")
+			Convey("Then each session has its own point", func() {
+				So(code, ShouldEqual, http.StatusOK)
+				So(len(series), ShouldEqual, 2)
+				So(series[0].TopSetWeight, ShouldEqual, 100)
+				So(series[0].TotalReps, ShouldEqual, 8)
+				So(series[0].TotalVolume, ShouldEqual, 100*5+90*3)
+				So(series[1].TopSetWeight, ShouldEqual, 105)
+				So(series[1].BestE1RM, ShouldBeGreaterThan, series[0].BestE1RM)
+			})
+		})
+		Convey("When the progress is bucketed by month", func() {
+			_, series := progress("?bucket=month")
+			Convey("Then both sessions fall in the same point", func() {
+				So(len(series), ShouldEqual, 1)
+				So(series[0].Sessions, ShouldEqual, 2)
+				So(series[0].TopSetWeight, ShouldEqual, 105)
+			})
+		})
+		Convey("When an unknown bucket is requested", func() {
+			code, _ := progress("?bucket=year")
+			Convey("Then an error is returned", func() {
+				So(code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestSetTypes(t *testing.T) {
+	Convey("Given a database and a workout with a working set", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		exercise := models.Exercise{Name: "Squat"}
+		db.Create(&exercise)
+		workout := models.Workout{Name: "Legs", UserID: user.ID}
+		db.Create(&workout)
+		workoutExercise := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: exercise.ID}
+		db.Create(&workoutExercise)
+		setsPath := "/workouts/" + strconv.Itoa(int(workout.ID)) + "/exercises/" + strconv.Itoa(int(workoutExercise.ID)) + "/sets"
+		exercisePath := "/users/" + strconv.Itoa(int(user.ID)) + "/exercises/" + strconv.Itoa(int(exercise.ID))
+		r := setupRouter(db)
+		addSet := func(set models.Set) (int, models.Set) {
+			body, _ := json.Marshal(set)
+			w := serve(r, token, "POST", setsPath, string(body))
+			var created models.Set
+			json.Unmarshal(w.Body.Bytes(), &created)
+			return w.Code, created
+		}
+		get := func(path string, response interface{}) int {
+			w := serve(r, token, "GET", path, "")
+			json.Unmarshal(w.Body.Bytes(), response)
+			return w.Code
+		}
+		_, working := addSet(models.Set{SetNumber: 1, Reps: 5, Weight: 100})
+		Convey("Then a set without a type is a working set", func() {
+			So(working.Type, ShouldEqual, models.SetTypeWorking)
+		})
+		Convey("When a set with an unknown type is added", func() {
+			code, _ := addSet(models.Set{SetNumber: 2, Type: "cluster", Reps: 5, Weight: 100})
+			Convey("Then an error is returned", func() {
+				So(code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+		Convey("When a heavier warm-up is added", func() {
+			code, warmup := addSet(models.Set{SetNumber: 2, Type: models.SetTypeWarmup, Reps: 5, Weight: 120})
+			So(code, ShouldEqual, http.StatusCreated)
+			Convey("Then it sets no record", func() {
+				So(warmup.Type, ShouldEqual, models.SetTypeWarmup)
+				So(warmup.Records, ShouldBeEmpty)
+			})
+			Convey("Then the progress leaves it out by default", func() {
+				var series []analytics.ProgressPoint
+				So(get(exercisePath+"/progress", &series), ShouldEqual, http.StatusOK)
+				So(len(series), ShouldEqual, 1)
+				So(series[0].TopSetWeight, ShouldEqual, 100)
+				So(series[0].TotalVolume, ShouldEqual, 500)
+			})
+			Convey("Then the progress includes it when every type is asked for", func() {
+				var series []analytics.ProgressPoint
+				So(get(exercisePath+"/progress?set_types=warmup,working", &series), ShouldEqual, http.StatusOK)
+				So(series[0].TopSetWeight, ShouldEqual, 120)
+				So(series[0].TotalVolume, ShouldEqual, 500+600)
+			})
+			Convey("Then the records can be replayed with it", func() {
+				var records []models.PersonalRecord
+				So(get(exercisePath+"/records?type=heaviest_weight&exclude_set_types=failure", &records), ShouldEqual, http.StatusOK)
+				So(len(records), ShouldEqual, 2)
+				So(records[1].Value, ShouldEqual, 120)
+			})
+			Convey("Then an unknown type filter is rejected", func() {
+				var response map[string]interface{}
+				So(get(exercisePath+"/progress?exclude_set_types=cluster", &response), ShouldEqual, http.StatusBadRequest)
+			})
+		})
+		Convey("When the working set is changed to a warm-up", func() {
+			w := serve(r, token, "PATCH", setsPath+"/"+strconv.Itoa(int(working.ID)), `{"Type": "warmup"}`)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			Convey("Then its records are removed", func() {
+				var records []models.PersonalRecord
+				get(exercisePath+"/records", &records)
+				So(records, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestSetEffort(t *testing.T) {
+	Convey("Given a database and a workout exercise", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		exercise := models.Exercise{Name: "Squat"}
+		db.Create(&exercise)
+		workout := models.Workout{Name: "Legs", UserID: user.ID}
+		db.Create(&workout)
+		workoutExercise := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: exercise.ID}
+		db.Create(&workoutExercise)
+		workoutPath := "/workouts/" + strconv.Itoa(int(workout.ID))
+		setsPath := workoutPath + "/exercises/" + strconv.Itoa(int(workoutExercise.ID)) + "/sets"
+		r := setupRouter(db)
+		addSet := func(body string) (int, models.Set) {
+			w := serve(r, token, "POST", setsPath, body)
+			var created models.Set
+			json.Unmarshal(w.Body.Bytes(), &created)
+			return w.Code, created
+		}
+		Convey("When a set is logged with an RPE and tempo", func() {
+			code, set := addSet(`{"SetNumber": 1, "Reps": 5, "Weight": 100, "RPE": 8, "Tempo": "3-1-X-0"}`)
+			So(code, ShouldEqual, http.StatusCreated)
+			Convey("Then its e1RM record comes from the RPE chart", func() {
+				So(*set.RPE, ShouldEqual, 8)
+				So(set.Tempo, ShouldEqual, "3-1-X-0")
+				for _, record := range set.Records {
+					if record.Type == string(analytics.BestE1RM) {
+						So(record.Value, ShouldAlmostEqual, 100/0.811, 0.01)
+					}
+				}
+			})
+			Convey("And a harder set is logged by reps in reserve", func() {
+				code, _ := addSet(`{"SetNumber": 2, "Reps": 5, "Weight": 100, "RIR": 1}`)
+				So(code, ShouldEqual, http.StatusCreated)
+				Convey("Then the workout details show the hardest effort", func() {
+					w := serve(r, token, "GET", workoutPath, "")
+					var details models.WorkoutDetails
+					json.Unmarshal(w.Body.Bytes(), &details)
+					So(len(details.Exercises), ShouldEqual, 1)
+					So(*details.Exercises[0].TopRPE, ShouldEqual, 9)
+					So(*details.Exercises[0].Sets[1].RIR, ShouldEqual, 1)
+				})
+			})
+		})
+		Convey("When the RPE is not in half steps", func() {
+			code, _ := addSet(`{"SetNumber": 1, "Reps": 5, "Weight": 100, "RPE": 7.3}`)
+			Convey("Then an error is returned", func() {
+				So(code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+		Convey("When the RPE is below 6", func() {
+			code, _ := addSet(`{"SetNumber": 1, "Reps": 5, "Weight": 100, "RPE": 5}`)
+			Convey("Then an error is returned", func() {
+				So(code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+		Convey("When the tempo has three phases", func() {
+			code, _ := addSet(`{"SetNumber": 1, "Reps": 5, "Weight": 100, "Tempo": "3-1-1"}`)
+			Convey("Then an error is returned", func() {
+				So(code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+	})
+}
+
+func TestMeasurementTypes(t *testing.T) {
+	Convey("Given a database and a workout with a rowing exercise", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		r := setupRouter(db)
+		w := serve(r, token, "POST", "/exercises", `{"Name": "Row", "Measurement": "distance_time"}`)
+		So(w.Code, ShouldEqual, http.StatusCreated)
+		var rowing models.Exercise
+		json.Unmarshal(w.Body.Bytes(), &rowing)
+		workout := models.Workout{Name: "Cardio", UserID: user.ID}
+		db.Create(&workout)
+		workoutExercise := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: rowing.ID}
+		db.Create(&workoutExercise)
+		setsPath := "/workouts/" + strconv.Itoa(int(workout.ID)) + "/exercises/" + strconv.Itoa(int(workoutExercise.ID)) + "/sets"
+		Convey("When a set with distance and time is added", func() {
+			w := serve(r, token, "POST", setsPath, `{"SetNumber": 1, "DistanceMeters": 2000, "DurationSeconds": 450, "HeartRate": 165}`)
+			Convey("Then it is created", func() {
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				var set models.Set
+				json.Unmarshal(w.Body.Bytes(), &set)
+				So(*set.DistanceMeters, ShouldEqual, 2000)
+				So(*set.DurationSeconds, ShouldEqual, 450)
+			})
+			Convey("And it is changed to reps and weight", func() {
+				var set models.Set
+				json.Unmarshal(w.Body.Bytes(), &set)
+				w := serve(r, token, "PATCH", setsPath+"/"+strconv.Itoa(int(set.ID)), `{"Reps": 5, "Weight": 100}`)
+				Convey("Then the fields the exercise does not measure are rejected", func() {
+					So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+					var response struct {
+						Fields map[string]string `json:"fields"`
+					}
+					json.Unmarshal(w.Body.Bytes(), &response)
+					So(response.Fields, ShouldContainKey, "Reps")
+					So(response.Fields, ShouldContainKey, "Weight")
+				})
+			})
+		})
+		Convey("When a set without a duration is added", func() {
+			w := serve(r, token, "POST", setsPath, `{"SetNumber": 1, "DistanceMeters": 2000}`)
+			Convey("Then an error is returned", func() {
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+		Convey("When a set with reps and weight is added", func() {
+			w := serve(r, token, "POST", setsPath, `{"SetNumber": 1, "Reps": 5, "Weight": 100}`)
+			Convey("Then an error is returned", func() {
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+		Convey("When an exercise with an unknown measurement type is created", func() {
+			w := serve(r, token, "POST", "/exercises", `{"Name": "Swim", "Measurement": "laps"}`)
+			Convey("Then an error is returned", func() {
+				So(w.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+		Convey("When an exercise is created without a measurement type", func() {
+			w := serve(r, token, "POST", "/exercises", `{"Name": "Squat"}`)
+			Convey("Then it is measured by reps and weight", func() {
+				var exercise models.Exercise
+				json.Unmarshal(w.Body.Bytes(), &exercise)
+				So(exercise.Measurement, ShouldEqual, models.RepsWeight)
+			})
+		})
+	})
+}
+
+func TestUnits(t *testing.T) {
+	Convey("Given a database and a lifter who prefers pounds", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		db.Model(&user).Update("preferred_unit", models.Pounds)
+		exercise := models.Exercise{Name: "Squat"}
+		db.Create(&exercise)
+		workout := models.Workout{Name: "Legs", UserID: user.ID}
+		db.Create(&workout)
+		workoutExercise := models.WorkoutExercise{WorkoutID: workout.ID, ExerciseID: exercise.ID}
+		db.Create(&workoutExercise)
+		setsPath := "/workouts/" + strconv.Itoa(int(workout.ID)) + "/exercises/" + strconv.Itoa(int(workoutExercise.ID)) + "/sets"
+		r := setupRouter(db)
+		request := func(method, path, body string) (int, models.Set) {
+			w := serve(r, token, method, path, body)
+			var set models.Set
+			json.Unmarshal(w.Body.Bytes(), &set)
+			return w.Code, set
+		}
+		Convey("When a set is logged without a unit", func() {
+			code, set := request("POST", setsPath, `{"SetNumber": 1, "Reps": 5, "Weight": 225}`)
+			So(code, ShouldEqual, http.StatusCreated)
+			setPath := setsPath + "/" + strconv.Itoa(int(set.ID))
+			Convey("Then it is stored in kilograms and returned in pounds as entered", func() {
+				So(set.Weight, ShouldEqual, 225)
+				So(set.Unit, ShouldEqual, models.Pounds)
+				var stored models.Set
+				db.First(&stored, set.ID)
+				So(stored.Weight, ShouldAlmostEqual, 102.058, 0.001)
+			})
+			Convey("Then asking for kilograms rounds to the plates", func() {
+				_, set := request("GET", setPath+"?unit=kg", "")
+				So(set.Weight, ShouldEqual, 102.5)
+				So(set.Unit, ShouldEqual, models.Kilograms)
+			})
+			Convey("Then the workout details are in pounds", func() {
+				w := serve(r, token, "GET", "/workouts/"+strconv.Itoa(int(workout.ID)), "")
+				var details models.WorkoutDetails
+				json.Unmarshal(w.Body.Bytes(), &details)
+				So(details.Exercises[0].Sets[0].Weight, ShouldEqual, 225)
+			})
+			Convey("Then its records, the record history and the progress are in pounds", func() {
+				So(set.Records, ShouldNotBeEmpty)
+				for _, record := range set.Records {
+					So(record.Weight, ShouldEqual, 225)
+				}
+				get := func(path string, response interface{}) {
+					w := serve(r, token, "GET", path, "")
+					json.Unmarshal(w.Body.Bytes(), response)
+				}
+				exercisePath := "/users/" + strconv.Itoa(int(user.ID)) + "/exercises/" + strconv.Itoa(int(exercise.ID))
+				var records []models.PersonalRecord
+				get(exercisePath+"/records?type=heaviest_weight", &records)
+				So(records[0].Value, ShouldEqual, 225)
+				var progress []analytics.ProgressPoint
+				get(exercisePath+"/progress", &progress)
+				So(progress[0].TopSetWeight, ShouldEqual, 225)
+				So(progress[0].TotalVolume, ShouldEqual, 1125)
+			})
+			Convey("And its weight is changed in kilograms", func() {
+				code, set := request("PATCH", setPath, `{"Weight": 100, "Unit": "kg"}`)
+				Convey("Then it is shown in pounds rounded to the plates", func() {
+					So(code, ShouldEqual, http.StatusOK)
+					So(set.Weight, ShouldEqual, 220)
+					_, set = request("GET", setPath+"?unit=kg", "")
+					So(set.Weight, ShouldEqual, 100)
+				})
+			})
+		})
+		Convey("When a set is logged in kilograms", func() {
+			_, set := request("POST", setsPath, `{"SetNumber": 1, "Reps": 5, "Weight": 60, "Unit": "kg"}`)
+			Convey("Then it is shown in pounds rounded to the plates", func() {
+				So(set.Weight, ShouldEqual, 130)
+			})
+		})
+		Convey("When a set is logged in an unknown unit", func() {
+			code, _ := request("POST", setsPath, `{"SetNumber": 1, "Reps": 5, "Weight": 60, "Unit": "stone"}`)
+			Convey("Then an error is returned", func() {
+				So(code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+		Convey("When the preferred unit is changed", func() {
+			w := serve(r, token, "PATCH", "/users/"+strconv.Itoa(int(user.ID)), `{"PreferredUnit": "kg"}`)
+			Convey("Then it is stored", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				var stored models.User
+				db.First(&stored, user.ID)
+				So(stored.PreferredUnit, ShouldEqual, models.Kilograms)
+			})
+		})
+	})
+}
+
+func TestExerciseCatalog(t *testing.T) {
+	Convey("Given a database with classified exercises", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		_, token := createTestUser(t, db, "tester")
+		r := setupRouter(db)
+		names := func(w *httptest.ResponseRecorder) []string {
+			var page models.Page[models.Exercise]
+			json.Unmarshal(w.Body.Bytes(), &page)
+			names := []string{}
+			for _, exercise := range page.Items {
+				names = append(names, exercise.Name)
+			}
+			return names
+		}
+		w := serve(r, token, "POST", "/exercises", `{"Name": "Bench Press", "PrimaryMuscles": [{"Key": "chest"}], "SecondaryMuscles": [{"Key": "triceps"}],
+			"Equipment": [{"Key": "barbell"}, {"Key": "bench"}], "MovementPattern": "horizontal_push", "Mechanic": "compound", "Force": "push"}`)
+		So(w.Code, ShouldEqual, http.StatusCreated)
+		var bench models.Exercise
+		json.Unmarshal(w.Body.Bytes(), &bench)
+		So(serve(r, token, "POST", "/exercises", `{"Name": "Dumbbell Fly", "PrimaryMuscles": [{"Key": "chest"}], "Equipment": [{"Key": "dumbbell"}], "Mechanic": "isolation"}`).Code, ShouldEqual, http.StatusCreated)
+		So(serve(r, token, "POST", "/exercises", `{"Name": "Skull Crusher", "PrimaryMuscles": [{"Key": "triceps"}], "Equipment": [{"Key": "ez_bar"}]}`).Code, ShouldEqual, http.StatusCreated)
+		Convey("When exercises are filtered by muscle", func() {
+			w := serve(r, token, "GET", "/exercises?muscle=triceps", "")
+			Convey("Then exercises training it as a primary or secondary muscle are listed", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(names(w), ShouldResemble, []string{"Bench Press", "Skull Crusher"})
+			})
+		})
+		Convey("When exercises are filtered by muscle and equipment", func() {
+			w := serve(r, token, "GET", "/exercises?muscle=chest&equipment=dumbbell", "")
+			Convey("Then only exercises matching both are listed", func() {
+				So(names(w), ShouldResemble, []string{"Dumbbell Fly"})
+			})
+		})
+		Convey("When an exercise is fetched", func() {
+			w := serve(r, token, "GET", "/exercises/"+strconv.Itoa(int(bench.ID)), "")
+			Convey("Then its classification is included", func() {
+				var exercise models.Exercise
+				json.Unmarshal(w.Body.Bytes(), &exercise)
+				So(exercise.PrimaryMuscles, ShouldHaveLength, 1)
+				So(exercise.PrimaryMuscles[0].Name, ShouldEqual, "Chest")
+				So(exercise.Equipment, ShouldHaveLength, 2)
+				So(exercise.MovementPattern, ShouldEqual, models.HorizontalPush)
+			})
+		})
+		Convey("When the muscles of an exercise are replaced", func() {
+			w := serve(r, token, "PATCH", "/exercises/"+strconv.Itoa(int(bench.ID)), `{"SecondaryMuscles": [{"Key": "shoulders"}]}`)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			Convey("Then it no longer matches the old muscle", func() {
+				So(names(serve(r, token, "GET", "/exercises?muscle=triceps", "")), ShouldResemble, []string{"Skull Crusher"})
+				So(names(serve(r, token, "GET", "/exercises?muscle=shoulders", "")), ShouldResemble, []string{"Bench Press"})
+			})
+		})
+		Convey("When an exercise is classified with unknown values", func() {
+			w := serve(r, token, "POST", "/exercises", `{"Name": "Curl", "PrimaryMuscles": [{"Key": "pecs"}], "Mechanic": "complex"}`)
+			Convey("Then every unknown value is listed", func() {
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+				var response struct {
+					Fields map[string]string `json:"fields"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &response)
+				So(response.Fields, ShouldContainKey, "PrimaryMuscles[0].Key")
+				So(response.Fields, ShouldContainKey, "Mechanic")
+				var count int64
+				db.Model(&models.MuscleGroup{}).Where("key = ?", "pecs").Count(&count)
+				So(count, ShouldEqual, 0)
+			})
+		})
+		Convey("When the muscle groups are listed", func() {
+			w := serve(r, token, "GET", "/muscle-groups", "")
+			Convey("Then the seeded reference is returned", func() {
+				var groups []models.MuscleGroup
+				json.Unmarshal(w.Body.Bytes(), &groups)
+				So(len(groups), ShouldBeGreaterThan, 10)
+			})
+		})
+	})
+}
+
+func TestWorkoutTemplates(t *testing.T) {
+	Convey("Given a database and two exercises", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		_, token := createTestUser(t, db, "tester")
+		squat := models.Exercise{Name: "Squat"}
+		db.Create(&squat)
+		lunge := models.Exercise{Name: "Lunge"}
+		db.Create(&lunge)
+		r := setupRouter(db)
+		send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+			data, _ := json.Marshal(body)
+			return serve(r, token, method, path, string(data))
+		}
+		Convey("When a template is created", func() {
+			w := send("POST", "/templates", models.WorkoutTemplate{
+				Name: "Leg day",
+				Exercises: []models.TemplateExercise{
+					{ExerciseID: squat.ID, TargetSets: 3, TargetReps: 5, TargetWeight: 100},
+					{ExerciseID: lunge.ID, TargetSets: 2, TargetReps: 10, TargetWeight: 20},
+				},
+			})
+			var template models.WorkoutTemplate
+			json.Unmarshal(w.Body.Bytes(), &template)
+			Convey("Then its exercises are numbered in order", func() {
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				So(len(template.Exercises), ShouldEqual, 2)
+				So(template.Exercises[0].Position, ShouldEqual, 1)
+				So(template.Exercises[1].Position, ShouldEqual, 2)
+			})
+			Convey("Then a workout can be started from it with planned sets", func() {
+				w := send("POST", "/templates/"+strconv.Itoa(int(template.ID))+"/instantiate", nil)
+				var details models.WorkoutDetails
+				json.Unmarshal(w.Body.Bytes(), &details)
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				So(details.Name, ShouldEqual, "Leg day")
+				So(len(details.Exercises), ShouldEqual, 2)
+				So(len(details.Exercises[0].Sets)+len(details.Exercises[1].Sets), ShouldEqual, 5)
+				for _, exercise := range details.Exercises {
+					for _, set := range exercise.Sets {
+						So(set.Planned, ShouldBeTrue)
+					}
+				}
+			})
+			Convey("Then its exercises can be replaced", func() {
+				w := send("PATCH", "/templates/"+strconv.Itoa(int(template.ID)), map[string]interface{}{
+					"Name":      "Lunge day",
+					"Exercises": []models.TemplateExercise{{ExerciseID: lunge.ID, TargetSets: 4, TargetReps: 8}},
+				})
+				var updated models.WorkoutTemplate
+				json.Unmarshal(w.Body.Bytes(), &updated)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(updated.Name, ShouldEqual, "Lunge day")
+				So(len(updated.Exercises), ShouldEqual, 1)
+				So(updated.Exercises[0].ExerciseID, ShouldEqual, lunge.ID)
+
+				var count int64
+				db.Model(&models.TemplateExercise{}).Where("template_id = ?", template.ID).Count(&count)
+				So(count, ShouldEqual, 1)
+			})
+		})
+		Convey("When a template is planned in pounds", func() {
+			w := send("POST", "/templates", models.WorkoutTemplate{
+				Name:      "Leg day",
+				Exercises: []models.TemplateExercise{{ExerciseID: squat.ID, TargetSets: 1, TargetReps: 5, TargetWeight: 227.5, Unit: models.Pounds}},
+			})
+			var template models.WorkoutTemplate
+			json.Unmarshal(w.Body.Bytes(), &template)
+			templatePath := "/templates/" + strconv.Itoa(int(template.ID))
+			Convey("Then the target is stored in kilograms", func() {
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				var stored models.TemplateExercise
+				db.First(&stored, template.Exercises[0].ID)
+				So(stored.TargetWeight, ShouldAlmostEqual, 103.19, 0.01)
+				So(stored.EnteredUnit, ShouldEqual, models.Pounds)
+			})
+			Convey("Then it reads back in pounds as planned", func() {
+				var fetched models.WorkoutTemplate
+				json.Unmarshal(send("GET", templatePath+"?unit=lb", nil).Body.Bytes(), &fetched)
+				So(fetched.Exercises[0].TargetWeight, ShouldEqual, 227.5)
+			})
+			Convey("Then the planned sets of a workout started from it are shown in the unit asked for", func() {
+				var details models.WorkoutDetails
+				json.Unmarshal(send("POST", templatePath+"/instantiate?unit=lb", nil).Body.Bytes(), &details)
+				So(details.Exercises[0].Sets[0].Weight, ShouldEqual, 227.5)
+				json.Unmarshal(send("POST", templatePath+"/instantiate", nil).Body.Bytes(), &details)
+				So(details.Exercises[0].Sets[0].Weight, ShouldEqual, 102.5)
+			})
+		})
+		Convey("When a template targets reps and weight on a timed exercise", func() {
+			plank := models.Exercise{Name: "Plank", Measurement: models.Time}
+			db.Create(&plank)
+			w := send("POST", "/templates", models.WorkoutTemplate{
+				Name:      "Core",
+				Exercises: []models.TemplateExercise{{ExerciseID: plank.ID, TargetSets: 3, TargetReps: 10, TargetWeight: 20}},
+			})
+			Convey("Then it is rejected like the planned sets would be", func() {
+				var response struct {
+					Fields map[string]string `json:"fields"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &response)
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+				So(response.Fields, ShouldContainKey, "Exercises[0].TargetReps")
+				So(response.Fields, ShouldContainKey, "Exercises[0].TargetWeight")
+			})
+		})
+		Convey("When a template references an unknown exercise", func() {
+			w := send("POST", "/templates", models.WorkoutTemplate{
+				Name:      "Leg day",
+				Exercises: []models.TemplateExercise{{ExerciseID: 9999, TargetSets: 3}},
+			})
+			Convey("Then it is rejected", func() {
+				So(w.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestWorkoutExerciseOrder(t *testing.T) {
+	Convey("Given a workout with three exercises", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		_, otherToken := createTestUser(t, db, "other")
+		workout := models.Workout{Name: "Full Body", UserID: user.ID}
+		db.Create(&workout)
+		workoutPath := "/workouts/" + strconv.Itoa(int(workout.ID))
+		r := setupRouter(db)
+		var ids []string
+		for _, name := range []string{"Squat", "Bench Press", "Row"} {
+			exercise := models.Exercise{Name: name}
+			db.Create(&exercise)
+			serve(r, token, "POST", workoutPath+"/exercises", `{"ExerciseID": `+strconv.Itoa(int(exercise.ID))+`}`)
+			var added models.WorkoutExercise
+			db.Where("workout_id = ? AND exercise_id = ?", workout.ID, exercise.ID).First(&added)
+			ids = append(ids, strconv.Itoa(int(added.ID)))
+		}
+		first, _ := strconv.Atoi(ids[0])
+		db.Create(&models.Set{WorkoutExerciseID: uint(first), SetNumber: 2, Reps: 5})
+		db.Create(&models.Set{WorkoutExerciseID: uint(first), SetNumber: 1, Reps: 8})
+		names := func() []string {
+			var details models.WorkoutDetails
+			json.Unmarshal(serve(r, token, "GET", workoutPath, "").Body.Bytes(), &details)
+			names := []string{}
+			for _, exercise := range details.Exercises {
+				names = append(names, exercise.Name)
+			}
+			return names
+		}
+		Convey("When the details are loaded", func() {
+			var details models.WorkoutDetails
+			json.Unmarshal(serve(r, token, "GET", workoutPath, "").Body.Bytes(), &details)
+			Convey("Then exercises come in the order added and sets by number", func() {
+				So(names(), ShouldResemble, []string{"Squat", "Bench Press", "Row"})
+				So(details.Exercises[0].Sets[0].SetNumber, ShouldEqual, 1)
+				So(details.Exercises[0].Sets[1].SetNumber, ShouldEqual, 2)
+			})
+		})
+		Convey("When the exercises are reordered", func() {
+			w := serve(r, token, "PUT", workoutPath+"/exercises/order", `{"WorkoutExerciseIDs": [`+ids[2]+`, `+ids[0]+`, `+ids[1]+`]}`)
+			Convey("Then the details follow the new order", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(names(), ShouldResemble, []string{"Row", "Squat", "Bench Press"})
+			})
+		})
+		Convey("When the new order leaves an exercise out or repeats one", func() {
+			missing := serve(r, token, "PUT", workoutPath+"/exercises/order", `{"WorkoutExerciseIDs": [`+ids[1]+`, `+ids[0]+`]}`)
+			repeated := serve(r, token, "PUT", workoutPath+"/exercises/order", `{"WorkoutExerciseIDs": [`+ids[1]+`, `+ids[1]+`, `+ids[0]+`]}`)
+			Convey("Then it is rejected and nothing moves", func() {
+				So(missing.Code, ShouldEqual, http.StatusUnprocessableEntity)
+				So(repeated.Code, ShouldEqual, http.StatusUnprocessableEntity)
+				So(names(), ShouldResemble, []string{"Squat", "Bench Press", "Row"})
+			})
+		})
+		Convey("When another user reorders the workout", func() {
+			w := serve(r, otherToken, "PUT", workoutPath+"/exercises/order", `{"WorkoutExerciseIDs": [`+ids[2]+`, `+ids[0]+`, `+ids[1]+`]}`)
+			Convey("Then it is not found", func() {
+				So(w.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestRemoveAndSubstituteExercise(t *testing.T) {
+	Convey("Given a workout with a logged exercise followed by another one", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		squat := models.Exercise{Name: "Squat"}
+		legPress := models.Exercise{Name: "Leg Press"}
+		plank := models.Exercise{Name: "Plank", Measurement: models.Time}
+		db.Create(&squat)
+		db.Create(&legPress)
+		db.Create(&plank)
+		workout := models.Workout{Name: "Legs", UserID: user.ID, Exercises: []models.WorkoutExercise{
+			{ExerciseID: squat.ID, Position: 1, Sets: []models.Set{{SetNumber: 1, Reps: 5, Weight: 100}}},
+			{ExerciseID: plank.ID, Position: 2},
+		}}
+		db.Create(&workout)
+		other := models.Workout{Name: "Other", UserID: user.ID}
+		db.Create(&other)
+		workoutPath := "/workouts/" + strconv.Itoa(int(workout.ID))
+		exercisePath := workoutPath + "/exercises/" + strconv.Itoa(int(workout.Exercises[0].ID))
+		r := setupRouter(db)
+		repo.NewRecordRepository(db).RecomputeRecords(user.ID, squat.ID)
+		Convey("When the exercise is removed", func() {
+			w := serve(r, token, "DELETE", exercisePath, "")
+			Convey("Then its sets and records go with it and the next exercise moves up", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				var sets, records int64
+				db.Model(&models.Set{}).Where("workout_exercise_id = ?", workout.Exercises[0].ID).Count(&sets)
+				db.Model(&models.PersonalRecord{}).Where("exercise_id = ?", squat.ID).Count(&records)
+				So(sets, ShouldEqual, 0)
+				So(records, ShouldEqual, 0)
+				var next models.WorkoutExercise
+				db.First(&next, workout.Exercises[1].ID)
+				So(next.Position, ShouldEqual, 1)
+			})
+		})
+		Convey("When the exercise is removed through another workout", func() {
+			w := serve(r, token, "DELETE", "/workouts/"+strconv.Itoa(int(other.ID))+"/exercises/"+strconv.Itoa(int(workout.Exercises[0].ID)), "")
+			Convey("Then it is not found", func() {
+				So(w.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+		Convey("When the exercise is substituted", func() {
+			w := serve(r, token, "POST", exercisePath+"/substitute", `{"ExerciseID": `+strconv.Itoa(int(legPress.ID))+`}`)
+			Convey("Then the sets and the records move to the new exercise", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				var details models.WorkoutDetails
+				json.Unmarshal(w.Body.Bytes(), &details)
+				So(details.Exercises[0].Name, ShouldEqual, "Leg Press")
+				So(len(details.Exercises[0].Sets), ShouldEqual, 1)
+				var old, moved int64
+				db.Model(&models.PersonalRecord{}).Where("exercise_id = ?", squat.ID).Count(&old)
+				db.Model(&models.PersonalRecord{}).Where("exercise_id = ?", legPress.ID).Count(&moved)
+				So(old, ShouldEqual, 0)
+				So(moved, ShouldBeGreaterThan, 0)
+			})
+		})
+		Convey("When the exercise is substituted with one its sets do not fit", func() {
+			w := serve(r, token, "POST", exercisePath+"/substitute", `{"ExerciseID": `+strconv.Itoa(int(plank.ID))+`}`)
+			Convey("Then it is rejected", func() {
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+				var stored models.WorkoutExercise
+				db.First(&stored, workout.Exercises[0].ID)
+				So(stored.ExerciseID, ShouldEqual, squat.ID)
+			})
+		})
+		Convey("When another user removes or substitutes the exercise through the repository", func() {
+			intruder, _ := createTestUser(t, db, "intruder")
+			workoutExercises := repo.NewWorkoutExerciseRepository(db)
+			removed := workoutExercises.DeleteWorkoutExercise(intruder.ID, &workout.Exercises[0])
+			substituted := workoutExercises.SubstituteExercise(intruder.ID, &workout.Exercises[0], legPress.ID)
+			Convey("Then neither is found and the exercise stays as it was", func() {
+				So(removed, ShouldEqual, gorm.ErrRecordNotFound)
+				So(substituted, ShouldEqual, gorm.ErrRecordNotFound)
+				var stored models.WorkoutExercise
+				db.First(&stored, workout.Exercises[0].ID)
+				So(stored.ExerciseID, ShouldEqual, squat.ID)
+				var sets int64
+				db.Model(&models.Set{}).Where("workout_exercise_id = ?", workout.Exercises[0].ID).Count(&sets)
+				So(sets, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestExerciseGroups(t *testing.T) {
+	Convey("Given three exercises", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		_, token := createTestUser(t, db, "tester")
+		var ids []uint
+		for _, name := range []string{"Squat", "Bench Press", "Row"} {
+			exercise := models.Exercise{Name: name}
+			db.Create(&exercise)
+			ids = append(ids, exercise.ID)
+		}
+		r := setupRouter(db)
+		type blocks struct {
+			models.WorkoutDetails
+			Blocks []models.WorkoutBlock
+		}
+		request := func(method, path string, body interface{}) (blocks, int) {
+			data, _ := json.Marshal(body)
+			w := serve(r, token, method, path, string(data))
+			var details blocks
+			json.Unmarshal(w.Body.Bytes(), &details)
+			return details, w.Code
+		}
+		groupID := uint(1)
+		sets := func(n int) []models.Set {
+			var sets []models.Set
+			for i := 0; i < n; i++ {
+				sets = append(sets, models.Set{Reps: 10, Weight: 50})
+			}
+			return sets
+		}
+		Convey("When a session with a superset is logged", func() {
+			details, code := request("POST", "/workouts/full", models.WorkoutDetails{Name: "Upper", Exercises: []models.ExerciseDetails{
+				{ID: ids[0], Sets: sets(1)},
+				{ID: ids[1], GroupID: &groupID, GroupType: models.GroupSuperset, Sets: sets(3)},
+				{ID: ids[2], GroupID: &groupID, GroupType: models.GroupSuperset, Sets: sets(2)},
+			}})
+			Convey("Then the superset is nested as one block with numbered rounds", func() {
+				So(code, ShouldEqual, http.StatusCreated)
+				So(len(details.Blocks), ShouldEqual, 2)
+				So(details.Blocks[0].GroupID, ShouldBeNil)
+				superset := details.Blocks[1]
+				So(superset.GroupType, ShouldEqual, models.GroupSuperset)
+				So(superset.Rounds, ShouldEqual, 3)
+				So(len(superset.Exercises), ShouldEqual, 2)
+				So(superset.Exercises[1].Sets[1].Round, ShouldEqual, 2)
+			})
+			Convey("Then removing one exercise of the superset splits it up", func() {
+				path := "/workouts/" + strconv.Itoa(int(details.ID)) + "/exercises/" + strconv.Itoa(int(details.Exercises[2].WorkoutExerciseID))
+				_, code := request("DELETE", path, nil)
+				details, _ := request("GET", "/workouts/"+strconv.Itoa(int(details.ID)), nil)
+				So(code, ShouldEqual, http.StatusOK)
+				So(details.Exercises[1].GroupID, ShouldBeNil)
+			})
+		})
+		Convey("When a logged group is invalid", func() {
+			_, tooBig := request("POST", "/workouts/full", models.WorkoutDetails{Name: "Upper", Exercises: []models.ExerciseDetails{
+				{ID: ids[0], GroupID: &groupID, GroupType: models.GroupSuperset},
+				{ID: ids[1], GroupID: &groupID, GroupType: models.GroupSuperset},
+				{ID: ids[2], GroupID: &groupID, GroupType: models.GroupSuperset},
+			}})
+			_, apart := request("POST", "/workouts/full", models.WorkoutDetails{Name: "Upper", Exercises: []models.ExerciseDetails{
+				{ID: ids[0], GroupID: &groupID, GroupType: models.GroupCircuit},
+				{ID: ids[1]},
+				{ID: ids[2], GroupID: &groupID, GroupType: models.GroupCircuit},
+			}})
+			Convey("Then it is rejected", func() {
+				So(tooBig, ShouldEqual, http.StatusUnprocessableEntity)
+				So(apart, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+		Convey("When exercises of a logged session are grouped", func() {
+			created, _ := request("POST", "/workouts/full", models.WorkoutDetails{Name: "Upper", Exercises: []models.ExerciseDetails{
+				{ID: ids[1]}, {ID: ids[0]}, {ID: ids[2]},
+			}})
+			workoutPath := "/workouts/" + strconv.Itoa(int(created.ID))
+			bench, squat, row := created.Exercises[0].WorkoutExerciseID, created.Exercises[1].WorkoutExerciseID, created.Exercises[2].WorkoutExerciseID
+			details, code := request("POST", workoutPath+"/groups", handlers.GroupRequest{Type: models.GroupSuperset, WorkoutExerciseIDs: []uint{row, bench}})
+			Convey("Then they move next to each other in the order given", func() {
+				So(code, ShouldEqual, http.StatusOK)
+				So(details.Exercises[0].Name, ShouldEqual, "Row")
+				So(details.Exercises[1].Name, ShouldEqual, "Bench Press")
+				So(details.Exercises[2].Name, ShouldEqual, "Squat")
+				So(*details.Blocks[0].GroupID, ShouldEqual, 1)
+			})
+			Convey("Then a reorder may not split the group", func() {
+				_, code := request("PUT", workoutPath+"/exercises/order", handlers.ReorderRequest{WorkoutExerciseIDs: []uint{row, squat, bench}})
+				So(code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+			Convey("Then an exercise cannot join a second group", func() {
+				_, code := request("POST", workoutPath+"/groups", handlers.GroupRequest{Type: models.GroupSuperset, WorkoutExerciseIDs: []uint{row, squat}})
+				So(code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+			Convey("Then the group can be split up again", func() {
+				details, code := request("DELETE", workoutPath+"/groups/1", nil)
+				So(code, ShouldEqual, http.StatusOK)
+				So(len(details.Blocks), ShouldEqual, 3)
+			})
+		})
+	})
+}
+
+func TestGroupSizes(t *testing.T) {
+	Convey("Given the group types", t, func() {
+		Convey("Then a group of the wrong size is described in plain English", func() {
+			So(models.GroupEMOM.ValidateSize(0), ShouldEqual, "an emom takes at least 1 exercise")
+			So(models.GroupSuperset.ValidateSize(3), ShouldEqual, "a superset takes exactly 2 exercises")
+			So(models.GroupCircuit.ValidateSize(1), ShouldEqual, "a circuit takes at least 2 exercises")
+			So(models.GroupEMOM.ValidateSize(1), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestCascadingDeletes(t *testing.T) {
+	Convey("Given a user with a logged workout, a template and a custom exercise with an alias", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		squat := models.Exercise{Name: "Squat"}
+		db.Create(&squat)
+		custom := models.Exercise{Name: "Box Squat", UserID: &user.ID}
+		db.Create(&custom)
+		db.Create(&models.ExerciseAlias{ExerciseID: custom.ID, UserID: &user.ID, Name: "Pause Squat"})
+		workout := models.Workout{Name: "Legs", UserID: user.ID, Exercises: []models.WorkoutExercise{
+			{ExerciseID: squat.ID, Position: 1, Sets: []models.Set{{SetNumber: 1, Reps: 5, Weight: 100}}},
+		}}
+		db.Create(&workout)
+		db.Create(&models.WorkoutTemplate{Name: "Legs", UserID: user.ID, Exercises: []models.TemplateExercise{
+			{ExerciseID: squat.ID, Position: 1, TargetSets: 3, TargetReps: 5},
+		}})
+		repo.NewRecordRepository(db).RecomputeRecords(user.ID, squat.ID)
+		workoutPath := "/workouts/" + strconv.Itoa(int(workout.ID))
+		r := setupRouter(db)
+		count := func(model interface{}, query string, args ...interface{}) int64 {
+			var n int64
+			db.Model(model).Where(query, args...).Count(&n)
+			return n
+		}
+		Convey("When the workout is deleted", func() {
+			w := serve(r, token, "DELETE", workoutPath, "")
+			Convey("Then its exercises, sets and records are gone as well", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(serve(r, token, "GET", workoutPath, "").Code, ShouldEqual, http.StatusNotFound)
+				So(count(&models.WorkoutExercise{}, "workout_id = ?", workout.ID), ShouldEqual, 0)
+				So(count(&models.Set{}, "workout_exercise_id = ?", workout.Exercises[0].ID), ShouldEqual, 0)
+				So(count(&models.PersonalRecord{}, "user_id = ?", user.ID), ShouldEqual, 0)
+			})
+		})
+		Convey("When the user is deleted", func() {
+			w := serve(r, token, "DELETE", "/users/"+strconv.Itoa(int(user.ID)), "")
+			Convey("Then everything they own is gone", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(count(&models.Workout{}, "user_id = ?", user.ID), ShouldEqual, 0)
+				So(count(&models.WorkoutExercise{}, "workout_id = ?", workout.ID), ShouldEqual, 0)
+				So(count(&models.Set{}, "workout_exercise_id = ?", workout.Exercises[0].ID), ShouldEqual, 0)
+				So(count(&models.PersonalRecord{}, "user_id = ?", user.ID), ShouldEqual, 0)
+				So(count(&models.WorkoutTemplate{}, "user_id = ?", user.ID), ShouldEqual, 0)
+				So(count(&models.TemplateExercise{}, "exercise_id = ?", squat.ID), ShouldEqual, 0)
+				So(count(&models.Exercise{}, "user_id = ?", user.ID), ShouldEqual, 0)
+				So(count(&models.ExerciseAlias{}, "exercise_id = ?", custom.ID), ShouldEqual, 0)
+				So(count(&models.Exercise{}, "id = ?", squat.ID), ShouldEqual, 1)
+			})
+			Convey("Then their token is no longer accepted", func() {
+				So(serve(r, token, "POST", "/workouts", `{"Name": "Legs"}`).Code, ShouldEqual, http.StatusUnauthorized)
+			})
+			Convey("Then their username can be registered again", func() {
+				w := serve(r, "", "POST", "/auth/register", `{"Username": "tester", "Password": "squat-1234"}`)
+				So(w.Code, ShouldEqual, http.StatusCreated)
+			})
+		})
+		Convey("When the workout row is hard deleted while its exercises are still there", func() {
+			err := db.Unscoped().Delete(&models.Workout{}, workout.ID).Error
+			Convey("Then the foreign key refuses, deletes go through the repositories", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When an exercise still logged in a workout is hard deleted", func() {
+			err := db.Unscoped().Delete(&models.Exercise{}, squat.ID).Error
+			Convey("Then the foreign key refuses", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When the custom exercise is hard deleted without its alias", func() {
+			db.Unscoped().Where("exercise_id = ?", custom.ID).Delete(&models.ExerciseAlias{})
+			Convey("Then it goes once nothing refers to it", func() {
+				So(db.Unscoped().Delete(&models.Exercise{}, custom.ID).Error, ShouldBeNil)
+			})
+			Convey("Then a template using it still keeps it", func() {
+				db.Create(&models.WorkoutTemplate{Name: "Box", UserID: user.ID, Exercises: []models.TemplateExercise{
+					{ExerciseID: custom.ID, Position: 1, TargetSets: 3, TargetReps: 5},
+				}})
+				So(db.Unscoped().Delete(&models.Exercise{}, custom.ID).Error, ShouldNotBeNil)
+			})
+		})
+		Convey("When a set is stored for a workout exercise that does not exist", func() {
+			err := db.Create(&models.Set{WorkoutExerciseID: workout.Exercises[0].ID + 100, SetNumber: 1, Reps: 5}).Error
+			Convey("Then the foreign key refuses", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestCreateFullWorkout(t *testing.T) {
+	Convey("Given a database and two exercises", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, token := createTestUser(t, db, "tester")
+		bench := models.Exercise{Name: "Bench Press"}
+		db.Create(&bench)
+		row := models.Exercise{Name: "Row"}
+		db.Create(&row)
+		var w *httptest.ResponseRecorder
+		r := setupRouter(db)
+		send := func(details models.WorkoutDetails) {
+			body, _ := json.Marshal(details)
+			w = serve(r, token, "POST", "/workouts/full", string(body))
+		}
+		countWorkouts := func() int64 {
+			var count int64
+			db.Model(&models.Workout{}).Where("user_id = ?", user.ID).Count(&count)
+			return count
+		}
+		Convey("When a whole session is logged", func() {
+			send(models.WorkoutDetails{
+				Name: "Upper",
+				Exercises: []models.ExerciseDetails{
+					{ID: bench.ID, Sets: []models.Set{{Reps: 5, Weight: 80}, {Reps: 5, Weight: 80}}},
+					{ID: row.ID, Sets: []models.Set{{Reps: 10, Weight: 60}}},
+				},
+			})
+			Convey("Then everything is created with numbered sets", func() {
+				var details models.WorkoutDetails
+				json.Unmarshal(w.Body.Bytes(), &details)
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				So(details.ID, ShouldNotBeZeroValue)
+				So(len(details.Exercises), ShouldEqual, 2)
+				for _, exercise := range details.Exercises {
+					So(exercise.WorkoutExerciseID, ShouldNotBeZeroValue)
+					for i, set := range exercise.Sets {
+						So(set.ID, ShouldNotBeZeroValue)
+						So(set.SetNumber, ShouldEqual, i+1)
+					}
+				}
+			})
+		})
+		Convey("When one of the sets is invalid", func() {
+			send(models.WorkoutDetails{
+				Name: "Upper",
+				Exercises: []models.ExerciseDetails{
+					{ID: bench.ID, Sets: []models.Set{{Reps: 5, Weight: 80}}},
+					{ID: row.ID, Sets: []models.Set{{Reps: -1, Weight: 60}}},
+				},
+			})
+			Convey("Then nothing is created", func() {
+				var response struct {
+					Fields map[string]string `json:"fields"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &response)
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+				So(response.Fields, ShouldContainKey, "Exercises[1].Sets[0].Reps")
+				So(countWorkouts(), ShouldEqual, 0)
+			})
+		})
+		Convey("When a session is logged in pounds", func() {
+			send(models.WorkoutDetails{
+				Name:      "Upper",
+				Exercises: []models.ExerciseDetails{{ID: bench.ID, Sets: []models.Set{{Reps: 5, Weight: 227.5, Unit: models.Pounds}}}},
+			})
+			var created models.WorkoutDetails
+			json.Unmarshal(w.Body.Bytes(), &created)
+			Convey("Then it reads back in pounds as entered", func() {
+				So(w.Code, ShouldEqual, http.StatusCreated)
+				w := serve(r, token, "GET", "/workouts/"+strconv.Itoa(int(created.ID))+"?unit=lb", "")
+				var details models.WorkoutDetails
+				json.Unmarshal(w.Body.Bytes(), &details)
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(details.Exercises[0].Sets[0].Weight, ShouldEqual, 227.5)
+				var stored models.Set
+				db.First(&stored, details.Exercises[0].Sets[0].ID)
+				So(stored.EnteredUnit, ShouldEqual, models.Pounds)
+			})
+		})
+		Convey("When a set number clashes with the sets numbered in order", func() {
+			send(models.WorkoutDetails{
+				Name: "Upper",
+				Exercises: []models.ExerciseDetails{
+					{ID: bench.ID, Sets: []models.Set{{SetNumber: 2, Reps: 5, Weight: 80}, {Reps: 5, Weight: 80}}},
+				},
+			})
+			Convey("Then nothing is created", func() {
+				var response struct {
+					Fields map[string]string `json:"fields"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &response)
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+				So(response.Fields, ShouldContainKey, "Exercises[0].Sets[0].SetNumber")
+				So(countWorkouts(), ShouldEqual, 0)
+			})
+		})
+		Convey("When one of the exercises does not exist", func() {
+			send(models.WorkoutDetails{
+				Name:      "Upper",
+				Exercises: []models.ExerciseDetails{{ID: 9999, Sets: []models.Set{{Reps: 5, Weight: 80}}}},
+			})
+			Convey("Then nothing is created", func() {
+				So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+				So(countWorkouts(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestWorkoutDetailsQueries(t *testing.T) {
+	Convey("Given a user with a short and a long workout", t, func() {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		user, _ := createTestUser(t, db, "tester")
+		short := createLoggedWorkouts(t, db, user.ID, 1, 1, 1)[0]
+		long := createLoggedWorkouts(t, db, user.ID, 1, 12, 5)[0]
+		other, _ := createTestUser(t, db, "other")
+		foreign := createLoggedWorkouts(t, db, other.ID, 1, 1, 1)[0]
+		workouts := repo.NewWorkoutRepository(db)
+		Convey("When the details are loaded", func() {
+			shortQueries := countQueries(db, func(db *gorm.DB) { repo.NewWorkoutRepository(db).GetWorkoutDetails(user.ID, int(short)) })
+			longQueries := countQueries(db, func(db *gorm.DB) { repo.NewWorkoutRepository(db).GetWorkoutDetails(user.ID, int(long)) })
+			Convey("Then the number of queries does not grow with the exercises", func() {
+				So(longQueries, ShouldEqual, shortQueries)
+				So(longQueries, ShouldBeLessThanOrEqualTo, 4)
+				details, err := workouts.GetWorkoutDetails(user.ID, int(long))
+				So(err, ShouldBeNil)
+				So(len(details.Exercises), ShouldEqual, 12)
+				So(details.Exercises[0].Name, ShouldEqual, "Squat")
+				So(details.Exercises[0].Sets[4].SetNumber, ShouldEqual, 5)
+			})
+		})
+		Convey("When several workouts are loaded at once", func() {
+			details, err := workouts.GetWorkoutDetailsMany(user.ID, []uint{long, foreign, short})
+			Convey("Then the user's workouts come back in the order asked", func() {
+				So(err, ShouldBeNil)
+				So(len(details), ShouldEqual, 2)
+				So(details[0].ID, ShouldEqual, long)
+				So(details[1].ID, ShouldEqual, short)
+			})
+		})
+	})
+}
+
+func BenchmarkGetWorkoutDetails(b *testing.B) {
+	db, cleanup := setupTestDB(b)
+	defer cleanup()
+	user, _ := createTestUser(b, db, "tester")
+	id := createLoggedWorkouts(b, db, user.ID, 1, 10, 5)[0]
+	b.ResetTimer()
+
+	queries := countQueries(db, func(db *gorm.DB) {
+		workouts := repo.NewWorkoutRepository(db)
+		for i := 0; i < b.N; i++ {
+			if _, err := workouts.GetWorkoutDetails(user.ID, int(id)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+}
+
+func BenchmarkGetWorkoutDetailsMany(b *testing.B) {
+	db, cleanup := setupTestDB(b)
+	defer cleanup()
+	user, _ := createTestUser(b, db, "tester")
+	ids := createLoggedWorkouts(b, db, user.ID, 20, 6, 4)
+	b.ResetTimer()
+
+	queries := countQueries(db, func(db *gorm.DB) {
+		workouts := repo.NewWorkoutRepository(db)
+		for i := 0; i < b.N; i++ {
+			if _, err := workouts.GetWorkoutDetailsMany(user.ID, ids); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+}
+
+func TestMigrations(t *testing.T) {
+	Convey("Given an empty database", t, func() {
+		db, err := database.Open(database.Config{Driver: database.SQLite, Path: database.MemoryPath})
+		So(err, ShouldBeNil)
+		all := migrations.All()
+		So(all, ShouldNotBeEmpty)
+		Convey("Then the schema is behind", func() {
+			So(errors.Is(migrations.Check(db), migrations.ErrSchemaBehind), ShouldBeTrue)
+		})
+		Convey("When the migrations are applied", func() {
+			applied, err := migrations.Up(db)
+			So(err, ShouldBeNil)
+			So(len(applied), ShouldEqual, len(all))
+			Convey("Then the schema is current and every migration is recorded", func() {
+				So(migrations.Check(db), ShouldBeNil)
+				So(db.Migrator().HasTable(&models.Workout{}), ShouldBeTrue)
+				So(db.Migrator().HasIndex("exercises", "idx_exercises_scope_name"), ShouldBeTrue)
+				states, err := migrations.Status(db)
+				So(err, ShouldBeNil)
+				for _, state := range states {
+					So(state.AppliedAt, ShouldNotBeNil)
+				}
+			})
+			Convey("Then applying them again does nothing", func() {
+				applied, err := migrations.Up(db)
+				So(err, ShouldBeNil)
+				So(applied, ShouldBeEmpty)
+			})
+			Convey("And the latest one is rolled back", func() {
+				rolledBack, err := migrations.Down(db, 1)
+				So(err, ShouldBeNil)
+				So(rolledBack, ShouldHaveLength, 1)
+				So(rolledBack[0].Version, ShouldEqual, all[len(all)-1].Version)
+				Convey("Then the schema is behind again until it is migrated up", func() {
+					So(errors.Is(migrations.Check(db), migrations.ErrSchemaBehind), ShouldBeTrue)
+					_, err := migrations.Up(db)
+					So(err, ShouldBeNil)
+					So(migrations.Check(db), ShouldBeNil)
+				})
+			})
+			Convey("And the foreign keys are added to rows referring to soft deleted ones", func() {
+				_, err := migrations.Down(db, len(all)-11)
+				So(err, ShouldBeNil)
+				user, _ := createTestUser(t, db, "tester")
+				exercise := models.Exercise{Name: "Squat"}
+				db.Create(&exercise)
+				kept := models.Workout{Name: "Legs", UserID: user.ID, Exercises: []models.WorkoutExercise{
+					{ExerciseID: exercise.ID, Sets: []models.Set{{SetNumber: 1, Reps: 5, Weight: 100}}},
+				}}
+				dropped := models.Workout{Name: "Legs", UserID: user.ID, Exercises: []models.WorkoutExercise{
+					{ExerciseID: exercise.ID, Sets: []models.Set{{SetNumber: 1, Reps: 5, Weight: 100}}},
+				}}
+				So(db.Create(&kept).Error, ShouldBeNil)
+				So(db.Create(&dropped).Error, ShouldBeNil)
+				db.Delete(&exercise)
+				db.Exec("UPDATE workouts SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", dropped.ID)
+				_, err = migrations.Up(db)
+				So(err, ShouldBeNil)
+				Convey("Then only what a soft deleted owner owns is soft deleted", func() {
+					live := func(model interface{}, query string, args ...interface{}) int64 {
+						var n int64
+						db.Model(model).Where(query, args...).Count(&n)
+						return n
+					}
+					So(live(&models.WorkoutExercise{}, "workout_id = ?", kept.ID), ShouldEqual, 1)
+					So(live(&models.Set{}, "workout_exercise_id = ?", kept.Exercises[0].ID), ShouldEqual, 1)
+					So(live(&models.WorkoutExercise{}, "workout_id = ?", dropped.ID), ShouldEqual, 0)
+					So(live(&models.Set{}, "workout_exercise_id = ?", dropped.Exercises[0].ID), ShouldEqual, 0)
+				})
+			})
+			Convey("And all of them are rolled back", func() {
+				rolledBack, err := migrations.Down(db, len(all))
+				So(err, ShouldBeNil)
+				So(len(rolledBack), ShouldEqual, len(all))
+				Convey("Then the tables are dropped", func() {
+					So(db.Migrator().HasTable(&models.Workout{}), ShouldBeFalse)
+					So(db.Migrator().HasTable(&models.User{}), ShouldBeFalse)
+				})
+			})
+		})
+	})
+}
@@ -1,10 +1,135 @@
 package models
 
 import (
+	"fmt"
+
 	"gorm.io/gorm"
 )
 
+// MeasurementType declares which fields the sets of an exercise are logged with
+type MeasurementType string
+
+const (
+	RepsWeight     MeasurementType = "reps_weight"     // e.g. squats
+	RepsOnly       MeasurementType = "reps"            // e.g. pull-ups
+	Time           MeasurementType = "time"            // e.g. planks
+	Distance       MeasurementType = "distance"        // e.g. a run logged by distance only
+	DistanceTime   MeasurementType = "distance_time"   // e.g. rowing
+	WeightDistance MeasurementType = "weight_distance" // e.g. farmer's carries
+)
+
+var MeasurementTypes = []MeasurementType{RepsWeight, RepsOnly, Time, Distance, DistanceTime, WeightDistance}
+
+const (
+	MinHeartRate = 30
+	MaxHeartRate = 250
+)
+
+func (m MeasurementType) Valid() bool {
+	for _, measurement := range MeasurementTypes {
+		if m == measurement {
+			return true
+		}
+	}
+	return false
+}
+
+// measures reports which of reps, weight, duration and distance the measurement type logs
+func (m MeasurementType) measures() (reps, weight, duration, distance bool) {
+	switch m {
+	case RepsOnly:
+		return true, false, false, false
+	case Time:
+		return false, false, true, false
+	case Distance:
+		return false, false, false, true
+	case DistanceTime:
+		return false, false, true, true
+	case WeightDistance:
+		return false, true, false, true
+	}
+	return true, true, false, false
+}
+
+// ValidateSet checks a set carries the fields the measurement type logs and none of the others.
+// Planned sets may leave the measured fields empty until they are performed.
+func (m MeasurementType) ValidateSet(set Set) FieldErrors {
+	errs := FieldErrors{}
+	reps, weight, duration, distance := m.measures()
+	notMeasured := fmt.Sprintf("not measured by %s exercises", m)
+
+	switch {
+	case !reps && set.Reps != 0:
+		errs["Reps"] = notMeasured
+	case reps && set.Reps < 0, reps && set.Reps == 0 && !set.Planned:
+		errs["Reps"] = "must be greater than 0"
+	}
+	switch {
+	case !weight && set.Weight != 0:
+		errs["Weight"] = notMeasured
+	case weight && set.Weight < 0:
+		errs["Weight"] = "cannot be negative"
+	}
+	switch {
+	case !duration && set.DurationSeconds != nil:
+		errs["DurationSeconds"] = notMeasured
+	case duration && set.DurationSeconds == nil && !set.Planned:
+		errs["DurationSeconds"] = "is required"
+	case duration && set.DurationSeconds != nil && *set.DurationSeconds < 1:
+		errs["DurationSeconds"] = "must be greater than 0"
+	}
+	switch {
+	case !distance && set.DistanceMeters != nil:
+		errs["DistanceMeters"] = notMeasured
+	case distance && set.DistanceMeters == nil && !set.Planned:
+		errs["DistanceMeters"] = "is required"
+	case distance && set.DistanceMeters != nil && *set.DistanceMeters <= 0:
+		errs["DistanceMeters"] = "must be greater than 0"
+	}
+
+	if set.HeartRate != nil && (*set.HeartRate < MinHeartRate || *set.HeartRate > MaxHeartRate) {
+		errs["HeartRate"] = fmt.Sprintf("must be between %d and %d", MinHeartRate, MaxHeartRate)
+	}
+	if set.Calories != nil && *set.Calories < 0 {
+		errs["Calories"] = "cannot be negative"
+	}
+	return errs
+}
+
 type Exercise struct {
 	gorm.Model
-	Name string `gorm:"not null"`
+	Name             string          `gorm:"not null"`                     // unique within its scope, ignoring case
+	UserID           *uint           `gorm:"index"`                        // owner of a custom exercise, nil for the global catalog
+	Measurement      MeasurementType `gorm:"not null;default:reps_weight"` // fixed once created, logged sets depend on it
+	PrimaryMuscles   []MuscleGroup   `gorm:"many2many:exercise_primary_muscles"`
+	SecondaryMuscles []MuscleGroup   `gorm:"many2many:exercise_secondary_muscles"`
+	Equipment        []Equipment     `gorm:"many2many:exercise_equipment"`
+	MovementPattern  MovementPattern
+	Mechanic         Mechanic
+	Force            Force
+	Aliases          []ExerciseAlias `gorm:"foreignKey:ExerciseID"` // names of exercises merged into this one
+}
+
+// ValidateMetadata checks the optional classification of the exercise. Muscle groups and equipment are checked
+// against the reference separately.
+func (e Exercise) ValidateMetadata() FieldErrors {
+	errs := FieldErrors{}
+	if e.MovementPattern != "" && !e.MovementPattern.Valid() {
+		errs["MovementPattern"] = "unknown movement pattern"
+	}
+	if e.Mechanic != "" && !e.Mechanic.Valid() {
+		errs["Mechanic"] = "must be compound or isolation"
+	}
+	if e.Force != "" && !e.Force.Valid() {
+		errs["Force"] = "must be push, pull or static"
+	}
+	return errs
+}
+
+// BeforeCreate defaults exercises created without a measurement type to reps and weight
+func (e *Exercise) BeforeCreate(tx *gorm.DB) error {
+	if e.Measurement == "" {
+		e.Measurement = RepsWeight
+	}
+	return nil
 }
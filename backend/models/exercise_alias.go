@@ -0,0 +1,21 @@
+package models
+
+import "gorm.io/gorm"
+
+// another name an exercise is found by, kept when exercises are merged into it. Like exercises, an alias is global
+// when UserID is nil and otherwise only seen by that user, so merging a custom exercise into a global one does not
+// show its name to everyone.
+type ExerciseAlias struct {
+	gorm.Model
+	ExerciseID uint   `gorm:"not null;index"`
+	UserID     *uint  `gorm:"index"`
+	Name       string `gorm:"not null"`
+}
+
+// an exercise found by a search, with the name or alias the query matched and how often the user did the exercise
+type ExerciseMatch struct {
+	Exercise
+	MatchedName string
+	Score       float64 // relevance of the match, 1 for an exact one
+	Uses        int64   // workouts of the user with the exercise
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GroupType tells how the exercises of a group are performed together, going round them set by set
+type GroupType string
+
+const (
+	GroupSuperset GroupType = "superset"  // two exercises back to back
+	GroupGiantSet GroupType = "giant_set" // three or more exercises back to back
+	GroupCircuit  GroupType = "circuit"
+	GroupEMOM     GroupType = "emom" // every minute on the minute, one round per minute
+)
+
+var GroupTypes = []GroupType{GroupSuperset, GroupGiantSet, GroupCircuit, GroupEMOM}
+
+func (t GroupType) Valid() bool {
+	for _, groupType := range GroupTypes {
+		if t == groupType {
+			return true
+		}
+	}
+	return false
+}
+
+// Size is how many exercises a group of the type takes, max is 0 when there is no upper limit
+func (t GroupType) Size() (min, max int) {
+	switch t {
+	case GroupSuperset:
+		return 2, 2
+	case GroupGiantSet:
+		return 3, 0
+	case GroupCircuit:
+		return 2, 0
+	}
+	return 1, 0
+}
+
+// ValidateSize checks a group of the type can have n exercises and returns a message describing the problem
+func (t GroupType) ValidateSize(n int) string {
+	min, max := t.Size()
+	switch {
+	case max > 0 && min == max && n != min:
+		return fmt.Sprintf("%s takes exactly %s", t.withArticle(), exercises(min))
+	case n < min:
+		return fmt.Sprintf("%s takes at least %s", t.withArticle(), exercises(min))
+	case max > 0 && n > max:
+		return fmt.Sprintf("%s takes at most %s", t.withArticle(), exercises(max))
+	}
+	return ""
+}
+
+// withArticle puts "a" or "an" before the type, by its first letter
+func (t GroupType) withArticle() string {
+	if len(t) > 0 && strings.ContainsRune("aeiou", rune(t[0])) {
+		return "an " + string(t)
+	}
+	return "a " + string(t)
+}
+
+func exercises(n int) string {
+	if n == 1 {
+		return "1 exercise"
+	}
+	return fmt.Sprintf("%d exercises", n)
+}
+
+// a block of a workout, either one exercise on its own or the exercises of a group. The sets of a group carry the
+// round they are performed in: round n is set n of each exercise, in the order of the exercises.
+type WorkoutBlock struct {
+	GroupID   *uint
+	GroupType GroupType `json:",omitempty"`
+	Rounds    int       `json:",omitempty"` // only for groups
+	Exercises []ExerciseDetails
+}
+
+// Blocks nests the exercises of the workout into blocks, keeping their order
+func (d WorkoutDetails) Blocks() []WorkoutBlock {
+	blocks := []WorkoutBlock{}
+	for _, exercise := range d.Exercises {
+		last := len(blocks) - 1
+		if exercise.GroupID != nil && last >= 0 && blocks[last].GroupID != nil && *blocks[last].GroupID == *exercise.GroupID {
+			blocks[last].Exercises = append(blocks[last].Exercises, exercise)
+			continue
+		}
+		blocks = append(blocks, WorkoutBlock{GroupID: exercise.GroupID, GroupType: exercise.GroupType, Exercises: []ExerciseDetails{exercise}})
+	}
+
+	for i, block := range blocks {
+		if block.GroupID == nil {
+			continue
+		}
+		exercises := make([]ExerciseDetails, len(block.Exercises))
+		for j, exercise := range block.Exercises {
+			sets := make([]Set, len(exercise.Sets))
+			for k, set := range exercise.Sets {
+				set.Round = k + 1
+				sets[k] = set
+			}
+			exercise.Sets = sets
+			exercises[j] = exercise
+			blocks[i].Rounds = max(blocks[i].Rounds, len(sets))
+		}
+		blocks[i].Exercises = exercises
+	}
+	return blocks
+}
+
+// MarshalJSON adds the exercises nested into blocks to the flat list of exercises
+func (d WorkoutDetails) MarshalJSON() ([]byte, error) {
+	type details WorkoutDetails
+	return json.Marshal(struct {
+		details
+		Blocks []WorkoutBlock
+	}{details(d), d.Blocks()})
+}
+
+// ValidateGroups checks the groups of a workout's exercises, given in order: every exercise of a group has the same
+// valid type, the group has the right size and its exercises come one after another. field names the exercise at an
+// index for the errors.
+func ValidateGroups(exercises []ExerciseDetails, field func(i int) string) FieldErrors {
+	errs := FieldErrors{}
+	sizes := map[uint]int{}
+	types := map[uint]GroupType{}
+	first := map[uint]int{}
+	for i, exercise := range exercises {
+		if exercise.GroupID == nil {
+			if exercise.GroupType != "" {
+				errs[field(i)+".GroupType"] = "needs a GroupID"
+			}
+			continue
+		}
+		id := *exercise.GroupID
+		switch groupType, seen := types[id]; {
+		case !exercise.GroupType.Valid():
+			errs[field(i)+".GroupType"] = "must be superset, giant_set, circuit or emom"
+		case seen && groupType != exercise.GroupType:
+			errs[field(i)+".GroupType"] = fmt.Sprintf("group %d is a %s", id, groupType)
+		case seen && (i == 0 || exercises[i-1].GroupID == nil || *exercises[i-1].GroupID != id):
+			errs[field(i)+".GroupID"] = fmt.Sprintf("exercises of group %d have to come one after another", id)
+		case !seen:
+			types[id], first[id] = exercise.GroupType, i
+		}
+		sizes[id]++
+	}
+	for id, i := range first {
+		if msg := types[id].ValidateSize(sizes[id]); msg != "" {
+			errs[field(i)+".GroupID"] = msg
+		}
+	}
+	return errs
+}
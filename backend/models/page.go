@@ -0,0 +1,7 @@
+package models
+
+// Page is the envelope every listing endpoint responds with. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor"`
+}
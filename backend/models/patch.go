@@ -0,0 +1,329 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FieldErrors maps a rejected request field to the reason it was rejected
+type FieldErrors map[string]string
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,30}$`)
+
+// ValidUsername reports whether a username is 3-30 letters, digits, '_', '.' or '-'
+func ValidUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
+
+// Patch models hold the fields a client may change on a resource; nil fields are left untouched
+
+type UserPatch struct {
+	Username      *string
+	Name          *string
+	PreferredUnit *Unit
+}
+
+func (p UserPatch) Validate() FieldErrors {
+	errs := FieldErrors{}
+	if p.Username != nil && !ValidUsername(*p.Username) {
+		errs["Username"] = "must be 3-30 letters, digits, '_', '.' or '-'"
+	}
+	if p.Name != nil && strings.TrimSpace(*p.Name) == "" {
+		errs["Name"] = "cannot be empty"
+	}
+	if p.PreferredUnit != nil && !p.PreferredUnit.Valid() {
+		errs["PreferredUnit"] = "must be kg or lb"
+	}
+	return errs
+}
+
+func (p UserPatch) Updates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if p.Username != nil {
+		updates["username"] = *p.Username
+	}
+	if p.Name != nil {
+		updates["name"] = *p.Name
+	}
+	if p.PreferredUnit != nil {
+		updates["preferred_unit"] = *p.PreferredUnit
+	}
+	return updates
+}
+
+type ExercisePatch struct {
+	Name             *string
+	PrimaryMuscles   *[]MuscleGroup
+	SecondaryMuscles *[]MuscleGroup
+	Equipment        *[]Equipment
+	MovementPattern  *MovementPattern
+	Mechanic         *Mechanic
+	Force            *Force
+}
+
+func (p ExercisePatch) Validate() FieldErrors {
+	errs := FieldErrors{}
+	if p.Name != nil && strings.TrimSpace(*p.Name) == "" {
+		errs["Name"] = "cannot be empty"
+	}
+	var patched Exercise
+	if p.MovementPattern != nil {
+		patched.MovementPattern = *p.MovementPattern
+	}
+	if p.Mechanic != nil {
+		patched.Mechanic = *p.Mechanic
+	}
+	if p.Force != nil {
+		patched.Force = *p.Force
+	}
+	for field, message := range patched.ValidateMetadata() {
+		errs[field] = message
+	}
+	return errs
+}
+
+func (p ExercisePatch) Updates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if p.Name != nil {
+		updates["name"] = *p.Name
+	}
+	if p.MovementPattern != nil {
+		updates["movement_pattern"] = *p.MovementPattern
+	}
+	if p.Mechanic != nil {
+		updates["mechanic"] = *p.Mechanic
+	}
+	if p.Force != nil {
+		updates["force"] = *p.Force
+	}
+	return updates
+}
+
+// Associations returns the muscle groups and equipment the patch replaces, by association name
+func (p ExercisePatch) Associations() map[string]interface{} {
+	associations := map[string]interface{}{}
+	if p.PrimaryMuscles != nil {
+		associations["PrimaryMuscles"] = *p.PrimaryMuscles
+	}
+	if p.SecondaryMuscles != nil {
+		associations["SecondaryMuscles"] = *p.SecondaryMuscles
+	}
+	if p.Equipment != nil {
+		associations["Equipment"] = *p.Equipment
+	}
+	return associations
+}
+
+type WorkoutPatch struct {
+	Name        *string
+	PerformedAt *time.Time
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+}
+
+func (p WorkoutPatch) Validate() FieldErrors {
+	errs := FieldErrors{}
+	if p.Name != nil && strings.TrimSpace(*p.Name) == "" {
+		errs["Name"] = "cannot be empty"
+	}
+	if p.PerformedAt != nil && p.PerformedAt.IsZero() {
+		errs["PerformedAt"] = "cannot be empty"
+	}
+	return errs
+}
+
+// ValidateTiming checks the patched start and finish times against the ones already stored on the workout
+func (p WorkoutPatch) ValidateTiming(workout *Workout) FieldErrors {
+	errs := FieldErrors{}
+	startedAt, finishedAt := workout.StartedAt, workout.FinishedAt
+	if p.StartedAt != nil {
+		startedAt = p.StartedAt
+	}
+	if p.FinishedAt != nil {
+		finishedAt = p.FinishedAt
+		if startedAt == nil {
+			errs["FinishedAt"] = "workout has not been started"
+		}
+	}
+	if startedAt != nil && finishedAt != nil && finishedAt.Before(*startedAt) {
+		errs["FinishedAt"] = "cannot be before StartedAt"
+	}
+	return errs
+}
+
+func (p WorkoutPatch) Updates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if p.Name != nil {
+		updates["name"] = *p.Name
+	}
+	if p.PerformedAt != nil {
+		updates["performed_at"] = *p.PerformedAt
+	}
+	if p.StartedAt != nil {
+		updates["started_at"] = *p.StartedAt
+	}
+	if p.FinishedAt != nil {
+		updates["finished_at"] = *p.FinishedAt
+	}
+	return updates
+}
+
+type SetPatch struct {
+	SetNumber       *int
+	Type            *SetType
+	Reps            *int
+	Weight          *float64
+	Unit            *Unit // of Weight, the user's preferred unit when not given
+	RPE             *float64
+	RIR             *int
+	Tempo           *string
+	Planned         *bool
+	DurationSeconds *int
+	DistanceMeters  *float64
+	HeartRate       *int
+	Calories        *int
+}
+
+func (p SetPatch) Validate() FieldErrors {
+	errs := FieldErrors{}
+	if p.SetNumber != nil && *p.SetNumber < 1 {
+		errs["SetNumber"] = "must be greater than 0"
+	}
+	if p.Type != nil && !p.Type.Valid() {
+		errs["Type"] = "unknown set type"
+	}
+	if p.Reps != nil && *p.Reps < 1 {
+		errs["Reps"] = "must be greater than 0"
+	}
+	// a weight of 0 is a bodyweight set, as when logging one
+	if p.Weight != nil && *p.Weight < 0 {
+		errs["Weight"] = "cannot be negative"
+	}
+	if p.Unit != nil && !p.Unit.Valid() {
+		errs["Unit"] = "must be kg or lb"
+	}
+	effort := Set{RPE: p.RPE, RIR: p.RIR}
+	if p.Tempo != nil {
+		effort.Tempo = *p.Tempo
+	}
+	for field, message := range effort.ValidateEffort() {
+		errs[field] = message
+	}
+	return errs
+}
+
+func (p SetPatch) Updates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if p.SetNumber != nil {
+		updates["set_number"] = *p.SetNumber
+	}
+	if p.Type != nil {
+		updates["type"] = *p.Type
+	}
+	if p.Reps != nil {
+		updates["reps"] = *p.Reps
+	}
+	if p.Weight != nil {
+		updates["weight"] = *p.Weight
+		if p.Unit != nil {
+			updates["entered_unit"] = *p.Unit
+		}
+	}
+	if p.RPE != nil {
+		updates["rpe"] = *p.RPE
+	}
+	if p.RIR != nil {
+		updates["rir"] = *p.RIR
+	}
+	if p.Tempo != nil {
+		updates["tempo"] = *p.Tempo
+	}
+	if p.DurationSeconds != nil {
+		updates["duration_seconds"] = *p.DurationSeconds
+	}
+	if p.DistanceMeters != nil {
+		updates["distance_meters"] = *p.DistanceMeters
+	}
+	if p.HeartRate != nil {
+		updates["heart_rate"] = *p.HeartRate
+	}
+	if p.Calories != nil {
+		updates["calories"] = *p.Calories
+	}
+	if p.Planned != nil {
+		updates["planned"] = *p.Planned
+	}
+	return updates
+}
+
+// Apply returns the set as it will be once the patch is stored, to validate it against its exercise
+func (p SetPatch) Apply(set Set) Set {
+	if p.SetNumber != nil {
+		set.SetNumber = *p.SetNumber
+	}
+	if p.Type != nil {
+		set.Type = *p.Type
+	}
+	if p.Reps != nil {
+		set.Reps = *p.Reps
+	}
+	if p.Weight != nil {
+		set.Weight = *p.Weight
+		if p.Unit != nil {
+			set.EnteredUnit = *p.Unit
+		}
+	}
+	if p.RPE != nil {
+		set.RPE = p.RPE
+	}
+	if p.RIR != nil {
+		set.RIR = p.RIR
+	}
+	if p.Tempo != nil {
+		set.Tempo = *p.Tempo
+	}
+	if p.Planned != nil {
+		set.Planned = *p.Planned
+	}
+	if p.DurationSeconds != nil {
+		set.DurationSeconds = p.DurationSeconds
+	}
+	if p.DistanceMeters != nil {
+		set.DistanceMeters = p.DistanceMeters
+	}
+	if p.HeartRate != nil {
+		set.HeartRate = p.HeartRate
+	}
+	if p.Calories != nil {
+		set.Calories = p.Calories
+	}
+	return set
+}
+
+// TemplatePatch replaces the whole exercise list of a template when Exercises is given
+type TemplatePatch struct {
+	Name      *string
+	Exercises *[]TemplateExercise
+}
+
+func (p TemplatePatch) Validate() FieldErrors {
+	errs := FieldErrors{}
+	if p.Name != nil && strings.TrimSpace(*p.Name) == "" {
+		errs["Name"] = "cannot be empty"
+	}
+	if p.Exercises != nil {
+		if msg := ValidateTemplateExercises(*p.Exercises); msg != "" {
+			errs["Exercises"] = msg
+		}
+	}
+	return errs
+}
+
+func (p TemplatePatch) Updates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if p.Name != nil {
+		updates["name"] = *p.Name
+	}
+	return updates
+}
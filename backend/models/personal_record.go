@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// a personal record a user set on an exercise, kept as a history so each improvement has its own row
+type PersonalRecord struct {
+	gorm.Model
+	UserID     uint   `gorm:"not null;index:idx_personal_records_user_exercise"`
+	ExerciseID uint   `gorm:"not null;index:idx_personal_records_user_exercise"`
+	SetID      uint   `gorm:"not null"`
+	Type       string `gorm:"not null"` // one of the analytics record types
+	Value      float64
+	Weight     float64
+	Reps       int
+	AchievedAt time.Time // when the workout of the set was performed
+}
@@ -1,12 +1,137 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SetType tells how a set was performed, so warm-ups and the like can be left out of the analytics
+type SetType string
+
+const (
+	SetTypeWarmup  SetType = "warmup"
+	SetTypeWorking SetType = "working"
+	SetTypeDropSet SetType = "dropset"
+	SetTypeFailure SetType = "failure"
+	SetTypeAMRAP   SetType = "amrap"
+	SetTypeBackoff SetType = "backoff"
+)
+
+var SetTypes = []SetType{SetTypeWarmup, SetTypeWorking, SetTypeDropSet, SetTypeFailure, SetTypeAMRAP, SetTypeBackoff}
+
+func (t SetType) Valid() bool {
+	for _, setType := range SetTypes {
+		if t == setType {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSetTypes parses a comma separated list of set types such as "working,amrap"
+func ParseSetTypes(s string) ([]SetType, error) {
+	var types []SetType
+	for _, part := range strings.Split(s, ",") {
+		setType := SetType(strings.TrimSpace(part))
+		if !setType.Valid() {
+			return nil, fmt.Errorf("unknown set type %q", part)
+		}
+		types = append(types, setType)
+	}
+	return types, nil
+}
+
+// SetTypeFilter selects the set types analytics are computed from. An empty Include keeps every type that is not excluded.
+type SetTypeFilter struct {
+	Include []SetType
+	Exclude []SetType
+}
+
+// DefaultSetTypeFilter leaves warm-ups out, they would otherwise count towards volume and records
+var DefaultSetTypeFilter = SetTypeFilter{Exclude: []SetType{SetTypeWarmup}}
+
+const (
+	MinRPE = 6
+	MaxRPE = 10
+	MaxRIR = 10
+)
+
+// tempo is written as four phases in seconds, eccentric-pause-concentric-pause, X marking an explosive phase
+var tempoPattern = regexp.MustCompile(`^(\d{1,2}|[xX])(-(\d{1,2}|[xX])){3}$`)
+
+// ValidRPE checks a rating of perceived exertion is between 6 and 10 in half steps
+func ValidRPE(rpe float64) bool {
+	return rpe >= MinRPE && rpe <= MaxRPE && math.Mod(rpe*2, 1) == 0
+}
+
+func ValidRIR(rir int) bool {
+	return rir >= 0 && rir <= MaxRIR
+}
+
+// ValidTempo checks tempo notation such as "3-1-1-0", an empty tempo is not given
+func ValidTempo(tempo string) bool {
+	return tempo == "" || tempoPattern.MatchString(tempo)
+}
 
 // represents a set for a workout exercise
 type Set struct {
 	gorm.Model
 	WorkoutExerciseID uint
-	SetNumber         int `gorm:"not null"`
+	SetNumber         int     `gorm:"not null"`
+	Type              SetType `gorm:"not null;default:working"`
 	Reps              int
-	Weight            float64
+	Weight            float64          // in Unit in requests and responses, stored in kilograms
+	Unit              Unit             `gorm:"-"`
+	EnteredUnit       Unit             `gorm:"not null;default:kg" json:"-"` // the unit the weight was logged in
+	RPE               *float64         // rating of perceived exertion, 6 to 10 in half steps
+	RIR               *int             // reps left in reserve
+	Tempo             string           // e.g. "3-1-1-0"
+	DurationSeconds   *int             // for time based exercises
+	DistanceMeters    *float64         // for distance based exercises
+	HeartRate         *int             // average beats per minute, optional
+	Calories          *int             // optional
+	Planned           bool             // pre-filled from a template and not performed yet
+	Records           []PersonalRecord `gorm:"-" json:",omitempty"` // records this set achieved, only filled in when it is logged
+	Round             int              `gorm:"-" json:",omitempty"` // round of the group the set is performed in, only filled in for workout blocks
+}
+
+// ValidateEffort checks the optional RPE, RIR and tempo of the set
+func (s Set) ValidateEffort() FieldErrors {
+	errs := FieldErrors{}
+	if s.RPE != nil && !ValidRPE(*s.RPE) {
+		errs["RPE"] = "must be between 6 and 10 in steps of 0.5"
+	}
+	if s.RIR != nil && !ValidRIR(*s.RIR) {
+		errs["RIR"] = fmt.Sprintf("must be between 0 and %d", MaxRIR)
+	}
+	if !ValidTempo(s.Tempo) {
+		errs["Tempo"] = "must be four phases such as 3-1-1-0"
+	}
+	return errs
+}
+
+// EffectiveRPE is the RPE of the set, derived from the reps in reserve when only those were logged
+func (s Set) EffectiveRPE() (float64, bool) {
+	switch {
+	case s.RPE != nil:
+		return *s.RPE, true
+	case s.RIR != nil:
+		return math.Max(MaxRPE-float64(*s.RIR), 0), true
+	}
+	return 0, false
+}
+
+// BeforeCreate defaults sets logged without a type to working sets, weighed in the canonical unit
+func (s *Set) BeforeCreate(tx *gorm.DB) error {
+	if s.Type == "" {
+		s.Type = SetTypeWorking
+	}
+	if s.EnteredUnit == "" {
+		s.EnteredUnit = CanonicalUnit
+	}
+	return nil
 }
@@ -0,0 +1,66 @@
+package models
+
+// MuscleGroup is an entry of the seeded muscle group reference, identified by a key such as "chest"
+type MuscleGroup struct {
+	Key    string `gorm:"primaryKey"`
+	Name   string `gorm:"not null"`
+	Region string // upper, lower or core
+}
+
+// Equipment is an entry of the seeded equipment reference, identified by a key such as "dumbbell"
+type Equipment struct {
+	Key  string `gorm:"primaryKey"`
+	Name string `gorm:"not null"`
+}
+
+// MovementPattern is the basic movement an exercise trains
+type MovementPattern string
+
+const (
+	Squat          MovementPattern = "squat"
+	Hinge          MovementPattern = "hinge"
+	Lunge          MovementPattern = "lunge"
+	HorizontalPush MovementPattern = "horizontal_push"
+	VerticalPush   MovementPattern = "vertical_push"
+	HorizontalPull MovementPattern = "horizontal_pull"
+	VerticalPull   MovementPattern = "vertical_pull"
+	Carry          MovementPattern = "carry"
+	Core           MovementPattern = "core"
+	Cardio         MovementPattern = "cardio"
+)
+
+var MovementPatterns = []MovementPattern{Squat, Hinge, Lunge, HorizontalPush, VerticalPush, HorizontalPull, VerticalPull, Carry, Core, Cardio}
+
+// Mechanic tells whether an exercise works several joints or one
+type Mechanic string
+
+const (
+	Compound  Mechanic = "compound"
+	Isolation Mechanic = "isolation"
+)
+
+// Force is the direction of the main effort of an exercise
+type Force string
+
+const (
+	Push   Force = "push"
+	Pull   Force = "pull"
+	Static Force = "static"
+)
+
+func (p MovementPattern) Valid() bool {
+	for _, pattern := range MovementPatterns {
+		if p == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (m Mechanic) Valid() bool {
+	return m == Compound || m == Isolation
+}
+
+func (f Force) Valid() bool {
+	return f == Push || f == Pull || f == Static
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Unit is a unit of weight. Weights are stored in kilograms and converted at the edges.
+type Unit string
+
+const (
+	Kilograms Unit = "kg"
+	Pounds    Unit = "lb"
+
+	CanonicalUnit = Kilograms
+
+	kilogramsPerPound = 0.45359237
+)
+
+// plateIncrement is the smallest load change a pair of the smallest common plates allows
+var plateIncrement = map[Unit]float64{
+	Kilograms: 2.5,
+	Pounds:    5,
+}
+
+func (u Unit) Valid() bool {
+	return u == Kilograms || u == Pounds
+}
+
+// ParseUnit resolves a unit name such as "kg" or "LB"
+func ParseUnit(name string) (Unit, error) {
+	unit := Unit(strings.ToLower(strings.TrimSpace(name)))
+	if !unit.Valid() {
+		return "", fmt.Errorf("unknown unit %q", name)
+	}
+	return unit, nil
+}
+
+// ToKilograms converts a weight given in the unit to the canonical unit
+func ToKilograms(weight float64, unit Unit) float64 {
+	if unit == Pounds {
+		return weight * kilogramsPerPound
+	}
+	return weight
+}
+
+// FromKilograms converts a stored weight to the unit without any rounding
+func FromKilograms(weight float64, unit Unit) float64 {
+	if unit == Pounds {
+		return weight / kilogramsPerPound
+	}
+	return weight
+}
+
+// RoundToPlates rounds a weight to the nearest load the plates of the unit can make
+func RoundToPlates(weight float64, unit Unit) float64 {
+	increment, ok := plateIncrement[unit]
+	if !ok {
+		return weight
+	}
+	return math.Round(weight/increment) * increment
+}
+
+// DisplayWeight converts a stored weight for display. A weight shown in the unit it was entered in comes back
+// as entered; one converted to the other unit is rounded to the plates of that unit, as 100 kg is loaded as 220 lb.
+func DisplayWeight(weight float64, entered, display Unit) float64 {
+	converted := FromKilograms(weight, display)
+	if entered != display {
+		return RoundToPlates(converted, display)
+	}
+	// drop the float noise of converting there and back
+	return math.Round(converted*1000) / 1000
+}
+
+// InUnit returns the set with its weight converted to the unit for display
+func (s Set) InUnit(unit Unit) Set {
+	s.Weight = DisplayWeight(s.Weight, s.EnteredUnit, unit)
+	s.Unit = unit
+	return s
+}
+
+// FromUnit converts the weight of a set given in its Unit, or in the fallback when it has none, to the canonical
+// unit and remembers the unit it was entered in
+func (s *Set) FromUnit(fallback Unit) {
+	if s.Unit == "" {
+		s.Unit = fallback
+	}
+	s.Weight = ToKilograms(s.Weight, s.Unit)
+	s.EnteredUnit = s.Unit
+}
+
+// FromUnit converts a patched weight like Set.FromUnit
+func (p *SetPatch) FromUnit(fallback Unit) {
+	if p.Weight == nil {
+		return
+	}
+	if p.Unit == nil {
+		p.Unit = &fallback
+	}
+	weight := ToKilograms(*p.Weight, *p.Unit)
+	p.Weight = &weight
+}
+
+// InUnit returns the details with the weights of every set converted to the unit for display
+func (d WorkoutDetails) InUnit(unit Unit) WorkoutDetails {
+	exercises := make([]ExerciseDetails, len(d.Exercises))
+	for i, exercise := range d.Exercises {
+		sets := make([]Set, len(exercise.Sets))
+		for j, set := range exercise.Sets {
+			sets[j] = set.InUnit(unit)
+		}
+		exercise.Sets = sets
+		exercises[i] = exercise
+	}
+	d.Exercises = exercises
+	return d
+}
+
+// FromUnit converts the target weight like Set.FromUnit
+func (e *TemplateExercise) FromUnit(fallback Unit) {
+	if e.Unit == "" {
+		e.Unit = fallback
+	}
+	e.TargetWeight = ToKilograms(e.TargetWeight, e.Unit)
+	e.EnteredUnit = e.Unit
+}
+
+// InUnit returns the template with the target weights converted to the unit for display
+func (t WorkoutTemplate) InUnit(unit Unit) WorkoutTemplate {
+	exercises := make([]TemplateExercise, len(t.Exercises))
+	for i, exercise := range t.Exercises {
+		exercise.TargetWeight = DisplayWeight(exercise.TargetWeight, exercise.EnteredUnit, unit)
+		exercise.Unit = unit
+		exercises[i] = exercise
+	}
+	t.Exercises = exercises
+	return t
+}
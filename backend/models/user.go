@@ -4,7 +4,18 @@ import "gorm.io/gorm"
 
 type User struct {
 	gorm.Model
-	Username string `gorm:"uniqueIndex;not null"`
-	Name     string
-	Workouts []Workout
+	Username      string `gorm:"uniqueIndex:idx_users_username,where:deleted_at IS NULL;not null"` // deleted users free their username
+	Name          string
+	PasswordHash  string `json:"-"`
+	PreferredUnit Unit   `gorm:"not null;default:kg"`    // weights are shown in this unit unless a request asks for another
+	IsAdmin       bool   `gorm:"not null;default:false"` // admins curate the global exercise catalog
+	Workouts      []Workout
+}
+
+// BeforeCreate defaults users to kilograms
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.PreferredUnit == "" {
+		u.PreferredUnit = CanonicalUnit
+	}
+	return nil
 }
@@ -1,11 +1,54 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // a workout belongs to one user
 type Workout struct {
 	gorm.Model
-	Name      string `gorm:"not null"`
-	UserID    uint
-	Exercises []WorkoutExercise
+	Name        string    `gorm:"not null"`
+	UserID      uint      `gorm:"index"`
+	PerformedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP;index"` // when the session happened, which can be back-logged
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+	Exercises   []WorkoutExercise
+}
+
+// BeforeCreate defaults the performed date to now for sessions that are logged live
+func (w *Workout) BeforeCreate(tx *gorm.DB) error {
+	if w.PerformedAt.IsZero() {
+		w.PerformedAt = time.Now()
+	}
+	return nil
+}
+
+// Duration is how long the session took, only known once it has been started and finished
+func (w Workout) Duration() (time.Duration, bool) {
+	if w.StartedAt == nil || w.FinishedAt == nil {
+		return 0, false
+	}
+	return w.FinishedAt.Sub(*w.StartedAt), true
+}
+
+// DurationSeconds is the duration in whole seconds, nil while the workout is not finished
+func (w Workout) DurationSeconds() *int64 {
+	d, ok := w.Duration()
+	if !ok {
+		return nil
+	}
+	seconds := int64(d.Seconds())
+	return &seconds
+}
+
+// MarshalJSON adds the computed DurationSeconds to the stored fields
+func (w Workout) MarshalJSON() ([]byte, error) {
+	type workout Workout
+	return json.Marshal(struct {
+		workout
+		DurationSeconds *int64
+	}{workout(w), w.DurationSeconds()})
 }
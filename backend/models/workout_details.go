@@ -1,13 +1,97 @@
 package models
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 type WorkoutDetails struct {
-	ID        uint   // workout id
-	Name      string // workout name
-	Exercises []ExerciseDetails
+	ID              uint   // workout id
+	Name            string // workout name
+	PerformedAt     time.Time
+	StartedAt       *time.Time
+	FinishedAt      *time.Time
+	DurationSeconds *int64 // only set once the workout is finished
+	Exercises       []ExerciseDetails
 }
 
 type ExerciseDetails struct {
-	ID   uint   // exercise workout id
-	Name string // exercise name
-	Sets []Set
+	ID                uint      // exercise id
+	WorkoutExerciseID uint      // id of the exercise within the workout, used by the set routes
+	Name              string    // exercise name
+	TopRPE            *float64  // hardest effort among the performed sets, nil when none has an RPE or RIR
+	GroupID           *uint     // group of the workout the exercise is performed in, see WorkoutBlock
+	GroupType         GroupType `json:",omitempty"`
+	Sets              []Set
+}
+
+// NewExerciseDetails summarises the sets of an exercise performed in a workout
+func NewExerciseDetails(exercise Exercise, workoutExercise WorkoutExercise) ExerciseDetails {
+	details := ExerciseDetails{
+		ID:                exercise.ID,
+		WorkoutExerciseID: workoutExercise.ID,
+		Name:              exercise.Name,
+		GroupID:           workoutExercise.GroupID,
+		GroupType:         workoutExercise.GroupType,
+		Sets:              workoutExercise.Sets,
+	}
+	for _, set := range workoutExercise.Sets {
+		rpe, ok := set.EffectiveRPE()
+		if !ok || set.Planned {
+			continue
+		}
+		if details.TopRPE == nil || rpe > *details.TopRPE {
+			details.TopRPE = &rpe
+		}
+	}
+	return details
+}
+
+// ValidateForCreate checks a whole logged session before it is created. Exercises are referenced by ID and
+// sets are numbered in the order given, a SetNumber may be left out but has to match that order when given.
+func (d WorkoutDetails) ValidateForCreate() FieldErrors {
+	errs := FieldErrors{}
+	if strings.TrimSpace(d.Name) == "" {
+		errs["Name"] = "cannot be empty"
+	}
+	if d.StartedAt == nil && d.FinishedAt != nil {
+		errs["FinishedAt"] = "workout has not been started"
+	}
+	if d.StartedAt != nil && d.FinishedAt != nil && d.FinishedAt.Before(*d.StartedAt) {
+		errs["FinishedAt"] = "cannot be before StartedAt"
+	}
+
+	for i, exercise := range d.Exercises {
+		field := fmt.Sprintf("Exercises[%d]", i)
+		if exercise.ID == 0 {
+			errs[field+".ID"] = "invalid exercise ID"
+		}
+
+		for j, set := range exercise.Sets {
+			field := fmt.Sprintf("%s.Sets[%d]", field, j)
+			if set.SetNumber != 0 && set.SetNumber != j+1 {
+				errs[field+".SetNumber"] = fmt.Sprintf("must be %d, sets are numbered in the order given", j+1)
+			}
+			if set.Type != "" && !set.Type.Valid() {
+				errs[field+".Type"] = "unknown set type"
+			}
+			if set.Reps < 0 {
+				errs[field+".Reps"] = "cannot be negative"
+			}
+			if set.Weight < 0 {
+				errs[field+".Weight"] = "cannot be negative"
+			}
+			if set.Unit != "" && !set.Unit.Valid() {
+				errs[field+".Unit"] = "must be kg or lb"
+			}
+			for name, message := range set.ValidateEffort() {
+				errs[field+"."+name] = message
+			}
+		}
+	}
+	for name, message := range ValidateGroups(d.Exercises, func(i int) string { return fmt.Sprintf("Exercises[%d]", i) }) {
+		errs[name] = message
+	}
+	return errs
 }
@@ -2,10 +2,13 @@ package models
 
 import "gorm.io/gorm"
 
-// Represents the many-to-many relationships between workouts and exercises
+// Represents the many-to-many relationships between workouts and exercises, ordered by Position within the workout
 type WorkoutExercise struct {
 	gorm.Model
-	WorkoutID  uint `gorm:"not null"`
-	ExerciseID uint `gorm:"not null"`
+	WorkoutID  uint      `gorm:"not null"`
+	ExerciseID uint      `gorm:"not null"`
+	Position   int       `gorm:"not null;default:0"`
+	GroupID    *uint     // numbers the groups within the workout, nil when the exercise is done on its own
+	GroupType  GroupType `json:",omitempty"`
 	Sets       []Set
 }
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// a reusable routine belonging to one user that workouts can be started from
+type WorkoutTemplate struct {
+	gorm.Model
+	Name      string             `gorm:"not null"`
+	UserID    uint               `gorm:"not null;index"`
+	Exercises []TemplateExercise `gorm:"foreignKey:TemplateID"`
+}
+
+// an exercise planned in a template, ordered by Position
+type TemplateExercise struct {
+	gorm.Model
+	TemplateID   uint `gorm:"not null;index"`
+	ExerciseID   uint `gorm:"not null"`
+	Position     int  `gorm:"not null"`
+	TargetSets   int
+	TargetReps   int
+	TargetWeight float64 // in Unit in requests and responses, stored in kilograms
+	Unit         Unit    `gorm:"-"`
+	EnteredUnit  Unit    `gorm:"not null;default:kg" json:"-"` // the unit the target was planned in, passed on to the planned sets
+}
+
+// ValidateTemplateExercises checks the planned targets of a template and returns a message describing the first problem
+func ValidateTemplateExercises(exercises []TemplateExercise) string {
+	for i, exercise := range exercises {
+		switch {
+		case exercise.ExerciseID == 0:
+			return fmt.Sprintf("exercise %d: invalid exercise ID", i+1)
+		case exercise.TargetSets < 0 || exercise.TargetReps < 0 || exercise.TargetWeight < 0:
+			return fmt.Sprintf("exercise %d: targets cannot be negative", i+1)
+		case exercise.Unit != "" && !exercise.Unit.Valid():
+			return fmt.Sprintf("exercise %d: unit must be kg or lb", i+1)
+		}
+	}
+	return ""
+}
+
+// ValidateTargets checks the targets fit how the exercise is measured, like the planned sets made from them would be
+func (e TemplateExercise) ValidateTargets(measurement MeasurementType) FieldErrors {
+	errs := FieldErrors{}
+	planned := Set{Reps: e.TargetReps, Weight: e.TargetWeight, Planned: true}
+	for name, message := range measurement.ValidateSet(planned) {
+		errs["Target"+name] = message
+	}
+	return errs
+}
@@ -1,40 +1,367 @@
 package repo
 
 import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
 	"workout/models"
+	"workout/search"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type ExerciseRepository struct {
+var (
+	ErrDuplicateName = errors.New("an exercise with this name already exists")
+	ErrExerciseInUse = errors.New("exercise is used by workouts or templates")
+)
+
+// exercise scopes, global exercises make up the shared catalog and custom ones belong to one user
+const (
+	ScopeGlobal = "global"
+	ScopeCustom = "custom"
+)
+
+// ExerciseFilter narrows an exercise listing; zero values do not filter
+type ExerciseFilter struct {
+	NamePrefix      string
+	Muscle          string // primary or secondary muscle group key
+	Equipment       string // equipment key
+	MovementPattern models.MovementPattern
+	Mechanic        models.Mechanic
+	Force           models.Force
+	Scope           string // global or custom, both when empty
+}
+
+var exerciseSortColumns = map[string]sortColumn{
+	"date": {"exercises.created_at", sortTime},
+	"name": {"exercises.name", sortString},
+}
+
+type ExerciseRepository interface {
+	CreateExercise(exercise *models.Exercise) error
+	GetExerciseByID(userID uint, id int) (*models.Exercise, error)
+	UpdateExercise(exercise *models.Exercise, updates map[string]interface{}, associations map[string]interface{}) error
+	DeleteExercise(exercise *models.Exercise) error
+	MergeExercises(target *models.Exercise, sources []models.Exercise) ([]uint, error)
+	ListExercises(userID uint, filter ExerciseFilter, page PageRequest) (*models.Page[models.Exercise], error)
+	SearchExercises(userID uint, query string, limit int) ([]models.ExerciseMatch, error)
+}
+
+type exerciseRepository struct {
 	db *gorm.DB
+
+	trigramOnce sync.Once
+	trigram     bool // whether pg_trgm is installed
 }
 
-func NewExerciseRepository(db *gorm.DB) *ExerciseRepository {
-	return &ExerciseRepository{db}
+func NewExerciseRepository(db *gorm.DB) ExerciseRepository {
+	return &exerciseRepository{db: db}
 }
 
-func (r *ExerciseRepository) CreateExercise(exercise *models.Exercise) error {
-	return r.db.Create(exercise).Error
+// CreateExercise creates the exercise in the scope its UserID gives, returning ErrDuplicateName when the scope
+// already has an exercise of that name in any case
+func (r *exerciseRepository) CreateExercise(exercise *models.Exercise) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkExerciseName(tx, exercise.UserID, exercise.Name, 0); err != nil {
+			return err
+		}
+		return tx.Create(exercise).Error
+	})
 }
 
-func (r *ExerciseRepository) GetExerciseByID(id int) (*models.Exercise, error) {
+// GetExerciseByID finds an exercise the user can see, a global one or one of their own
+func (r *exerciseRepository) GetExerciseByID(userID uint, id int) (*models.Exercise, error) {
 	var exercise models.Exercise
-	err := r.db.First(&exercise, id).Error
+	err := withAliases(withMetadata(visibleExercises(r.db, userID)), userID).First(&exercise, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &exercise, nil
 }
 
-func (r *ExerciseRepository) UpdateExercise(exercise *models.Exercise, updates map[string]interface{}) error {
-	return r.db.Model(exercise).Updates(updates).Error
+// UpdateExercise applies the column updates and replaces the muscle group and equipment associations named in associations
+func (r *exerciseRepository) UpdateExercise(exercise *models.Exercise, updates map[string]interface{}, associations map[string]interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if name, ok := updates["name"].(string); ok {
+			if err := checkExerciseName(tx, exercise.UserID, name, exercise.ID); err != nil {
+				return err
+			}
+		}
+		if len(updates) > 0 {
+			err := tx.Model(exercise).Omit(clause.Associations).Updates(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+		for name, values := range associations {
+			err := tx.Model(exercise).Association(name).Replace(values)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (r *ExerciseRepository) DeleteExercise(id int) error {
-	return r.db.Delete(&models.Exercise{}, id).Error
+// DeleteExercise deletes the exercise and its aliases unless a workout or template still uses it, returning
+// ErrExerciseInUse then
+func (r *exerciseRepository) DeleteExercise(exercise *models.Exercise) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.WorkoutExercise{}, &models.TemplateExercise{}} {
+			var count int64
+			err := tx.Model(model).Where("exercise_id = ?", exercise.ID).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrExerciseInUse
+			}
+		}
+		err := tx.Where("exercise_id = ?", exercise.ID).Delete(&models.ExerciseAlias{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(exercise).Error
+	})
 }
 
-func (r *ExerciseRepository) AddExerciseToWorkout(exercise *models.WorkoutExercise) error {
-	return r.db.Create(exercise).Error
+// MergeExercises folds the sources into the target: workouts, templates and aliases of the sources move to the target,
+// their names are kept as aliases and the sources are deleted. Records of the sources are deleted as well, they have to
+// be recomputed for the target for each of the returned users who logged a source.
+func (r *exerciseRepository) MergeExercises(target *models.Exercise, sources []models.Exercise) ([]uint, error) {
+	var sourceIDs []uint
+	for _, source := range sources {
+		sourceIDs = append(sourceIDs, source.ID)
+	}
+
+	var userIDs []uint
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Workout{}).Unscoped().Distinct().
+			Where("id IN (?)", tx.Model(&models.WorkoutExercise{}).Unscoped().Select("workout_id").Where("exercise_id IN ?", sourceIDs)).
+			Pluck("user_id", &userIDs).Error
+		if err != nil {
+			return err
+		}
+
+		// soft deleted rows move too, nothing may keep pointing at a deleted source
+		for _, model := range []interface{}{&models.WorkoutExercise{}, &models.TemplateExercise{}, &models.ExerciseAlias{}} {
+			err := tx.Model(model).Unscoped().Where("exercise_id IN ?", sourceIDs).Update("exercise_id", target.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Unscoped().Where("exercise_id IN ?", sourceIDs).Delete(&models.PersonalRecord{}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, source := range sources {
+			if strings.EqualFold(source.Name, target.Name) {
+				continue
+			}
+			err := tx.Create(&models.ExerciseAlias{ExerciseID: target.ID, UserID: source.UserID, Name: source.Name}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.Exercise{}, sourceIDs).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+func (r *exerciseRepository) ListExercises(userID uint, filter ExerciseFilter, page PageRequest) (*models.Page[models.Exercise], error) {
+	query := withAliases(withMetadata(visibleExercises(r.db, userID)), userID).Model(&models.Exercise{})
+	switch filter.Scope {
+	case ScopeGlobal:
+		query = query.Where("exercises.user_id IS NULL")
+	case ScopeCustom:
+		query = query.Where("exercises.user_id = ?", userID)
+	}
+	if filter.NamePrefix != "" {
+		// names of exercises merged into one still find it
+		pattern := prefixPattern(filter.NamePrefix)
+		query = query.Where(`LOWER(exercises.name) LIKE ? ESCAPE '\' OR exercises.id IN (?)`, pattern,
+			visibleAliases(r.db, userID).Select("exercise_id").Where(`LOWER(name) LIKE ? ESCAPE '\'`, pattern))
+	}
+	if filter.Muscle != "" {
+		query = query.Where("exercises.id IN (?) OR exercises.id IN (?)",
+			r.db.Table("exercise_primary_muscles").Select("exercise_id").Where("muscle_group_key = ?", filter.Muscle),
+			r.db.Table("exercise_secondary_muscles").Select("exercise_id").Where("muscle_group_key = ?", filter.Muscle))
+	}
+	if filter.Equipment != "" {
+		query = query.Where("exercises.id IN (?)",
+			r.db.Table("exercise_equipment").Select("exercise_id").Where("equipment_key = ?", filter.Equipment))
+	}
+	if filter.MovementPattern != "" {
+		query = query.Where("exercises.movement_pattern = ?", filter.MovementPattern)
+	}
+	if filter.Mechanic != "" {
+		query = query.Where("exercises.mechanic = ?", filter.Mechanic)
+	}
+	if filter.Force != "" {
+		query = query.Where("exercises.force = ?", filter.Force)
+	}
+
+	return paginate(query, "exercises", page, "name", exerciseSortColumns, func(e models.Exercise, sort string) (interface{}, uint) {
+		if sort == "date" {
+			return e.CreatedAt, e.ID
+		}
+		return e.Name, e.ID
+	})
+}
+
+// minimum pg_trgm word similarity for an exercise to be a search candidate, the pg_trgm default for similarity
+const trigramThreshold = 0.3
+
+// SearchExercises finds the exercises the user can see whose name or alias matches the query by prefix, with typos
+// or through a common abbreviation. The exercises the user does most often come first, after exact matches.
+// With pg_trgm, Postgres narrows the candidates down; without it, every visible exercise is scored in the app.
+func (r *exerciseRepository) SearchExercises(userID uint, query string, limit int) ([]models.ExerciseMatch, error) {
+	terms := []string{search.Normalize(query)}
+	if expanded := search.Expand(query); expanded != terms[0] {
+		terms = append(terms, expanded)
+	}
+
+	candidates := withAliases(withMetadata(visibleExercises(r.db, userID)), userID)
+	if r.hasTrigram() {
+		conditions := r.db
+		for _, term := range terms {
+			// normalized terms are only letters, digits and spaces, nothing to escape
+			pattern := "%" + term + "%"
+			conditions = conditions.
+				Or("LOWER(exercises.name) LIKE ? OR word_similarity(?, LOWER(exercises.name)) >= ?", pattern, term, trigramThreshold).
+				Or("exercises.id IN (?)", visibleAliases(r.db, userID).Select("exercise_id").
+					Where("LOWER(name) LIKE ? OR word_similarity(?, LOWER(name)) >= ?", pattern, term, trigramThreshold))
+		}
+		candidates = candidates.Where(conditions)
+	}
+	var exercises []models.Exercise
+	if err := candidates.Find(&exercises).Error; err != nil {
+		return nil, err
+	}
+
+	var matches []models.ExerciseMatch
+	var ids []uint
+	for _, exercise := range exercises {
+		match := models.ExerciseMatch{Exercise: exercise}
+		for i, term := range terms {
+			penalty := 1.0
+			if i > 0 {
+				penalty = search.AliasPenalty
+			}
+			if score := search.Score(term, exercise.Name) * penalty; score > match.Score {
+				match.Score, match.MatchedName = score, exercise.Name
+			}
+			for _, alias := range exercise.Aliases {
+				if score := search.Score(term, alias.Name) * penalty * search.AliasPenalty; score > match.Score {
+					match.Score, match.MatchedName = score, alias.Name
+				}
+			}
+		}
+		if match.Score > 0 {
+			matches = append(matches, match)
+			ids = append(ids, exercise.ID)
+		}
+	}
+	if len(matches) == 0 {
+		return []models.ExerciseMatch{}, nil
+	}
+
+	var uses []struct {
+		ExerciseID uint
+		Uses       int64
+	}
+	err := r.db.Model(&models.WorkoutExercise{}).
+		Select("workout_exercises.exercise_id, COUNT(DISTINCT workout_exercises.workout_id) AS uses").
+		Joins("JOIN workouts ON workouts.id = workout_exercises.workout_id AND workouts.deleted_at IS NULL").
+		Where("workouts.user_id = ? AND workout_exercises.exercise_id IN ?", userID, ids).
+		Group("workout_exercises.exercise_id").
+		Scan(&uses).Error
+	if err != nil {
+		return nil, err
+	}
+	usesByID := map[uint]int64{}
+	for _, u := range uses {
+		usesByID[u.ExerciseID] = u.Uses
+	}
+	for i := range matches {
+		matches[i].Uses = usesByID[matches[i].ID]
+	}
+
+	exact := func(m models.ExerciseMatch) bool {
+		return m.Score >= search.ExactMatch*search.AliasPenalty*search.AliasPenalty
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		switch {
+		case exact(a) != exact(b):
+			return exact(a)
+		case a.Uses != b.Uses:
+			return a.Uses > b.Uses
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// hasTrigram checks once whether the database is Postgres with the pg_trgm extension installed
+func (r *exerciseRepository) hasTrigram() bool {
+	r.trigramOnce.Do(func() {
+		if r.db.Dialector.Name() != "postgres" {
+			return
+		}
+		var count int64
+		err := r.db.Table("pg_extension").Where("extname = ?", "pg_trgm").Count(&count).Error
+		r.trigram = err == nil && count > 0
+	})
+	return r.trigram
+}
+
+// withMetadata loads the muscle groups and equipment of the exercises
+func withMetadata(db *gorm.DB) *gorm.DB {
+	return db.Preload("PrimaryMuscles").Preload("SecondaryMuscles").Preload("Equipment")
+}
+
+// withAliases loads the aliases of the exercises the user can see
+func withAliases(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Preload("Aliases", "user_id IS NULL OR user_id = ?", userID)
+}
+
+// visibleAliases selects the global aliases and those of the user's merged custom exercises
+func visibleAliases(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Model(&models.ExerciseAlias{}).Where("user_id IS NULL OR user_id = ?", userID)
+}
+
+// visibleExercises restricts an exercise query to the global catalog and the user's custom exercises
+func visibleExercises(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Where("exercises.user_id IS NULL OR exercises.user_id = ?", userID)
+}
+
+// checkExerciseName returns ErrDuplicateName when another exercise of the scope has the name, ignoring case
+func checkExerciseName(db *gorm.DB, userID *uint, name string, excludeID uint) error {
+	query := db.Model(&models.Exercise{}).Where("LOWER(name) = ? AND id <> ?", strings.ToLower(strings.TrimSpace(name)), excludeID)
+	if userID == nil {
+		query = query.Where("user_id IS NULL")
+	} else {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateName
+	}
+	return nil
 }
@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"workout/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort key")
+)
+
+// PageRequest describes which page of a listing to load. Sort is one of the sort keys the listing
+// supports, prefixed with '-' for descending order; an empty Sort uses the listing's default.
+type PageRequest struct {
+	Limit  int
+	Cursor string
+	Sort   string
+}
+
+type sortKind int
+
+const (
+	sortString sortKind = iota
+	sortInt
+	sortTime
+)
+
+// sortColumn is the column behind an API sort key and the type of the values it holds
+type sortColumn struct {
+	column string
+	kind   sortKind
+}
+
+type cursor struct {
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// paginate applies keyset pagination to query, ordering by the sort column with the primary key as tie breaker.
+// key returns the value of the sort key and the ID of an item, which the next cursor is built from.
+func paginate[T any](query *gorm.DB, table string, req PageRequest, defaultSort string, columns map[string]sortColumn, key func(item T, sort string) (interface{}, uint)) (*models.Page[T], error) {
+	sort := req.Sort
+	if sort == "" {
+		sort = defaultSort
+	}
+	desc := strings.HasPrefix(sort, "-")
+	sort = strings.TrimPrefix(sort, "-")
+	col, ok := columns[sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	op, dir := ">", "ASC"
+	if desc {
+		op, dir = "<", "DESC"
+	}
+	idColumn := table + ".id"
+
+	if req.Cursor != "" {
+		value, id, err := decodeCursor(req.Cursor, col.kind)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(
+			fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", col.column, op, col.column, idColumn, op),
+			value, value, id,
+		)
+	}
+
+	items := []T{}
+	err := query.Order(col.column + " " + dir).Order(idColumn + " " + dir).Limit(limit + 1).Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.Page[T]{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.NextCursor = encodeCursor(key(items[limit-1], sort))
+	}
+	return page, nil
+}
+
+func encodeCursor(value interface{}, id uint) string {
+	c := cursor{ID: id}
+	switch v := value.(type) {
+	case time.Time:
+		c.Value = v.Format(time.RFC3339Nano)
+	default:
+		c.Value = fmt.Sprint(v)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, kind sortKind) (interface{}, uint, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == 0 {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	switch kind {
+	case sortInt:
+		n, err := strconv.Atoi(c.Value)
+		if err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return n, c.ID, nil
+	case sortTime:
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return t.Local(), c.ID, nil
+	default:
+		return c.Value, c.ID, nil
+	}
+}
+
+// prefixPattern builds a case-insensitive LIKE pattern matching values starting with prefix, for use with ESCAPE '\'
+func prefixPattern(prefix string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(prefix))
+	return escaped + "%"
+}
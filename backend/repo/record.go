@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"workout/analytics"
+	"workout/models"
+
+	"gorm.io/gorm"
+)
+
+type RecordRepository interface {
+	ListRecords(userID uint, exerciseID int, recordType string) ([]models.PersonalRecord, error)
+	RecomputeRecords(userID, exerciseID uint) ([]models.PersonalRecord, error)
+	ReplayRecords(userID, exerciseID uint, filter models.SetTypeFilter, formula analytics.Formula) ([]models.PersonalRecord, error)
+}
+
+type recordRepository struct {
+	db *gorm.DB
+}
+
+func NewRecordRepository(db *gorm.DB) RecordRepository {
+	return &recordRepository{db}
+}
+
+func (r *recordRepository) ListRecords(userID uint, exerciseID int, recordType string) (records []models.PersonalRecord, err error) {
+	query := r.db.Where("user_id = ? AND exercise_id = ?", userID, exerciseID)
+	if recordType != "" {
+		query = query.Where("type = ?", recordType)
+	}
+	err = query.Order("achieved_at, id").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// RecomputeRecords replays every set the user logged for the exercise and replaces the stored record history.
+// Recomputing instead of comparing against the current bests keeps the history right when sets are
+// back-logged into older workouts, edited or deleted. Stored records leave out the default excluded set types and
+// estimate one-rep maxes with the default formula.
+func (r *recordRepository) RecomputeRecords(userID, exerciseID uint) ([]models.PersonalRecord, error) {
+	var records []models.PersonalRecord
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		records, err = replayRecords(tx, userID, exerciseID, models.DefaultSetTypeFilter, analytics.DefaultFormula)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().Where("user_id = ? AND exercise_id = ?", userID, exerciseID).Delete(&models.PersonalRecord{}).Error
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ReplayRecords computes the record history from the sets of the filtered types with the formula without storing it
+func (r *recordRepository) ReplayRecords(userID, exerciseID uint, filter models.SetTypeFilter, formula analytics.Formula) ([]models.PersonalRecord, error) {
+	return replayRecords(r.db, userID, exerciseID, filter, formula)
+}
+
+func replayRecords(db *gorm.DB, userID, exerciseID uint, filter models.SetTypeFilter, formula analytics.Formula) ([]models.PersonalRecord, error) {
+	var sets []analytics.SetEntry
+	err := exerciseHistory(db, userID, exerciseID, filter).Scan(&sets).Error
+	if err != nil {
+		return nil, err
+	}
+
+	records := []models.PersonalRecord{}
+	for _, record := range analytics.RecordHistory(formula, sets) {
+		records = append(records, models.PersonalRecord{
+			UserID:     userID,
+			ExerciseID: exerciseID,
+			SetID:      record.SetID,
+			Type:       string(record.Type),
+			Value:      record.Value,
+			Weight:     record.Weight,
+			Reps:       record.Reps,
+			AchievedAt: record.AchievedAt,
+		})
+	}
+	return records, nil
+}
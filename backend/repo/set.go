@@ -1,45 +1,164 @@
 package repo
 
 import (
+	"time"
+	"workout/analytics"
 	"workout/models"
 
 	"gorm.io/gorm"
 )
 
-type SetRepository struct {
+var setSortColumns = map[string]sortColumn{
+	"set_number": {"sets.set_number", sortInt},
+	"date":       {"sets.created_at", sortTime},
+}
+
+type SetRepository interface {
+	CreateSet(userID uint, set *models.Set) error
+	GetSetByID(userID uint, exerciseId, id int) (*models.Set, error)
+	UpdateSet(userID uint, set *models.Set, updates map[string]interface{}) error
+	DeleteSet(userID uint, exerciseId, id int) error
+	GetSetsForExercise(userID uint, exerciseId int) ([]models.Set, error)
+	ListSets(userID uint, exerciseId int, page PageRequest) (*models.Page[models.Set], error)
+	GetExerciseHistory(userID, exerciseID uint, from, to *time.Time, filter models.SetTypeFilter) ([]analytics.SetEntry, error)
+}
+
+type setRepository struct {
 	db *gorm.DB
 }
 
-func NewSetRepository(db *gorm.DB) *SetRepository {
-	return &SetRepository{db}
+func NewSetRepository(db *gorm.DB) SetRepository {
+	return &setRepository{db}
 }
 
-func (r *SetRepository) CreateSet(set *models.Set) error {
+func (r *setRepository) CreateSet(userID uint, set *models.Set) error {
+	var count int64
+	err := r.db.Model(&models.WorkoutExercise{}).
+		Where("id IN (?)", ownedWorkoutExerciseIDs(r.db, userID)).
+		Where("id = ?", set.WorkoutExerciseID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
 	return r.db.Create(set).Error
 }
 
-func (r *SetRepository) GetSetByID(id int) (*models.Set, error) {
+func (r *setRepository) GetSetByID(userID uint, exerciseId, id int) (*models.Set, error) {
 	var set models.Set
-	err := r.db.First(&set, id).Error
+	err := r.owned(userID).Where("workout_exercise_id = ?", exerciseId).First(&set, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &set, nil
 }
 
-func (r *SetRepository) UpdateSet(set *models.Set, updates map[string]interface{}) error {
-	return r.db.Model(set).Updates(updates).Error
+// UpdateSet applies the updates. A set given a new set number moves there and the sets in between shift by one
+// towards its old number, so set numbers stay contiguous.
+func (r *setRepository) UpdateSet(userID uint, set *models.Set, updates map[string]interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		owned := tx.Where("workout_exercise_id IN (?)", ownedWorkoutExerciseIDs(tx, userID))
+		if number, ok := updates["set_number"].(int); ok && number != set.SetNumber {
+			shift := owned.Session(&gorm.Session{}).Model(&models.Set{}).
+				Where("workout_exercise_id = ? AND id <> ?", set.WorkoutExerciseID, set.ID)
+			var err error
+			if number < set.SetNumber {
+				err = shift.Where("set_number >= ? AND set_number < ?", number, set.SetNumber).
+					Update("set_number", gorm.Expr("set_number + 1")).Error
+			} else {
+				err = shift.Where("set_number > ? AND set_number <= ?", set.SetNumber, number).
+					Update("set_number", gorm.Expr("set_number - 1")).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return owned.Model(set).Updates(updates).Error
+	})
 }
 
-func (r *SetRepository) DeleteSet(id int) error {
-	return r.db.Delete(&models.Set{}, id).Error
+// DeleteSet removes the set and shifts the later sets of the same exercise down so set numbers stay contiguous
+func (r *setRepository) DeleteSet(userID uint, exerciseId, id int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var set models.Set
+		err := tx.Where("workout_exercise_id IN (?)", ownedWorkoutExerciseIDs(tx, userID)).
+			Where("workout_exercise_id = ?", exerciseId).
+			First(&set, id).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(&set).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Set{}).
+			Where("workout_exercise_id = ? AND set_number > ?", set.WorkoutExerciseID, set.SetNumber).
+			Update("set_number", gorm.Expr("set_number - 1")).Error
+	})
 }
 
-func (r *SetRepository) GetSetsForExercise(exerciseId int) (sets []models.Set, err error) {
-	err = r.db.Where("workout_exercise_id", exerciseId).Find(&sets).Error
+func (r *setRepository) GetSetsForExercise(userID uint, exerciseId int) (sets []models.Set, err error) {
+	err = r.owned(userID).Where("workout_exercise_id = ?", exerciseId).Order("set_number, id").Find(&sets).Error
 	if err != nil {
 		return nil, err
 	}
 
 	return sets, nil
 }
+
+func (r *setRepository) ListSets(userID uint, exerciseId int, page PageRequest) (*models.Page[models.Set], error) {
+	query := r.owned(userID).Model(&models.Set{}).Where("sets.workout_exercise_id = ?", exerciseId)
+
+	return paginate(query, "sets", page, "set_number", setSortColumns, func(s models.Set, sort string) (interface{}, uint) {
+		if sort == "date" {
+			return s.CreatedAt, s.ID
+		}
+		return s.SetNumber, s.ID
+	})
+}
+
+// GetExerciseHistory returns every set the user logged for an exercise in the order they were performed.
+// From and to optionally bound the performed date, to being exclusive, and the filter selects the set types.
+func (r *setRepository) GetExerciseHistory(userID, exerciseID uint, from, to *time.Time, filter models.SetTypeFilter) (sets []analytics.SetEntry, err error) {
+	query := exerciseHistory(r.db, userID, exerciseID, filter)
+	if from != nil {
+		query = query.Where("workouts.performed_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("workouts.performed_at < ?", *to)
+	}
+	err = query.Scan(&sets).Error
+	if err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// exerciseHistory selects the user's performed sets of the filtered types of an exercise as analytics set entries,
+// in the order they were performed
+func exerciseHistory(db *gorm.DB, userID, exerciseID uint, filter models.SetTypeFilter) *gorm.DB {
+	query := db.Model(&models.Set{})
+	if len(filter.Include) > 0 {
+		query = query.Where("sets.type IN ?", filter.Include)
+	}
+	if len(filter.Exclude) > 0 {
+		query = query.Where("sets.type NOT IN ?", filter.Exclude)
+	}
+	return query.
+		Select("sets.id AS set_id, workouts.id AS workout_id, sets.weight, sets.reps, COALESCE(sets.rpe, 10 - sets.rir) AS rpe, "+
+			"COALESCE(sets.duration_seconds, 0) AS duration_seconds, COALESCE(sets.distance_meters, 0) AS distance_meters, workouts.performed_at").
+		Joins("JOIN workout_exercises ON workout_exercises.id = sets.workout_exercise_id AND workout_exercises.deleted_at IS NULL").
+		Joins("JOIN workouts ON workouts.id = workout_exercises.workout_id AND workouts.deleted_at IS NULL").
+		Where("workouts.user_id = ? AND workout_exercises.exercise_id = ?", userID, exerciseID).
+		Where("sets.planned = ?", false).
+		Order("workouts.performed_at, workout_exercises.id, sets.set_number")
+}
+
+// owned restricts a set query to sets logged in the user's workouts
+func (r *setRepository) owned(userID uint) *gorm.DB {
+	return r.db.Where("workout_exercise_id IN (?)", ownedWorkoutExerciseIDs(r.db, userID))
+}
@@ -0,0 +1,36 @@
+package repo
+
+import (
+	"workout/models"
+
+	"gorm.io/gorm"
+)
+
+type TaxonomyRepository interface {
+	ListMuscleGroups() ([]models.MuscleGroup, error)
+	ListEquipment() ([]models.Equipment, error)
+}
+
+type taxonomyRepository struct {
+	db *gorm.DB
+}
+
+func NewTaxonomyRepository(db *gorm.DB) TaxonomyRepository {
+	return &taxonomyRepository{db}
+}
+
+func (r *taxonomyRepository) ListMuscleGroups() (groups []models.MuscleGroup, err error) {
+	err = r.db.Order("key").Find(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *taxonomyRepository) ListEquipment() (equipment []models.Equipment, err error) {
+	err = r.db.Order("key").Find(&equipment).Error
+	if err != nil {
+		return nil, err
+	}
+	return equipment, nil
+}
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"workout/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var templateSortColumns = map[string]sortColumn{
+	"date": {"workout_templates.created_at", sortTime},
+	"name": {"workout_templates.name", sortString},
+}
+
+type TemplateRepository interface {
+	CreateTemplate(template *models.WorkoutTemplate) error
+	GetTemplateByID(userID uint, id int) (*models.WorkoutTemplate, error)
+	ListTemplates(userID uint, page PageRequest) (*models.Page[models.WorkoutTemplate], error)
+	UpdateTemplate(userID uint, template *models.WorkoutTemplate, updates map[string]interface{}, exercises *[]models.TemplateExercise) error
+	DeleteTemplate(userID uint, id int) error
+	InstantiateTemplate(template *models.WorkoutTemplate, workout *models.Workout) error
+}
+
+type templateRepository struct {
+	db *gorm.DB
+}
+
+func NewTemplateRepository(db *gorm.DB) TemplateRepository {
+	return &templateRepository{db}
+}
+
+// CreateTemplate creates the template along with its exercises
+func (r *templateRepository) CreateTemplate(template *models.WorkoutTemplate) error {
+	return r.db.Create(template).Error
+}
+
+func (r *templateRepository) GetTemplateByID(userID uint, id int) (*models.WorkoutTemplate, error) {
+	var template models.WorkoutTemplate
+	err := r.db.Preload("Exercises", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Where("user_id = ?", userID).First(&template, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (r *templateRepository) ListTemplates(userID uint, page PageRequest) (*models.Page[models.WorkoutTemplate], error) {
+	query := r.db.Model(&models.WorkoutTemplate{}).Where("workout_templates.user_id = ?", userID)
+
+	return paginate(query, "workout_templates", page, "name", templateSortColumns, func(t models.WorkoutTemplate, sort string) (interface{}, uint) {
+		if sort == "date" {
+			return t.CreatedAt, t.ID
+		}
+		return t.Name, t.ID
+	})
+}
+
+// UpdateTemplate applies the updates and, when exercises is not nil, replaces the exercises of the template
+func (r *templateRepository) UpdateTemplate(userID uint, template *models.WorkoutTemplate, updates map[string]interface{}, exercises *[]models.TemplateExercise) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			err := tx.Model(template).Omit(clause.Associations).Where("user_id = ?", userID).Updates(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+		if exercises == nil {
+			return nil
+		}
+
+		err := tx.Where("template_id = ?", template.ID).Delete(&models.TemplateExercise{}).Error
+		if err != nil {
+			return err
+		}
+		for i := range *exercises {
+			(*exercises)[i].TemplateID = template.ID
+		}
+		if len(*exercises) > 0 {
+			err = tx.Create(exercises).Error
+			if err != nil {
+				return err
+			}
+		}
+		template.Exercises = *exercises
+		return nil
+	})
+}
+
+func (r *templateRepository) DeleteTemplate(userID uint, id int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ?", userID).Delete(&models.WorkoutTemplate{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("template_id = ?", id).Delete(&models.TemplateExercise{}).Error
+	})
+}
+
+// InstantiateTemplate creates the workout with one workout exercise per template exercise, each pre-filled
+// with its target sets marked as planned. Either everything is created or nothing is.
+func (r *templateRepository) InstantiateTemplate(template *models.WorkoutTemplate, workout *models.Workout) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(workout).Error
+		if err != nil {
+			return err
+		}
+
+		for i, planned := range template.Exercises {
+			workoutExercise := models.WorkoutExercise{
+				WorkoutID:  workout.ID,
+				ExerciseID: planned.ExerciseID,
+				Position:   i + 1,
+			}
+			for n := 1; n <= planned.TargetSets; n++ {
+				workoutExercise.Sets = append(workoutExercise.Sets, models.Set{
+					SetNumber:   n,
+					Reps:        planned.TargetReps,
+					Weight:      planned.TargetWeight,
+					EnteredUnit: planned.EnteredUnit,
+					Planned:     true,
+				})
+			}
+
+			err = tx.Create(&workoutExercise).Error
+			if err != nil {
+				return err
+			}
+			workout.Exercises = append(workout.Exercises, workoutExercise)
+		}
+		return nil
+	})
+}
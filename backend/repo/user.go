@@ -6,19 +6,27 @@ import (
 	"gorm.io/gorm"
 )
 
-type UserRepository struct {
+type UserRepository interface {
+	CreateUser(user *models.User) error
+	GetUserByID(id int) (*models.User, error)
+	UpdateUser(user *models.User, updates map[string]interface{}) error
+	DeleteUser(id int) error
+	GetUserByUsername(username string) (*models.User, error)
+}
+
+type userRepository struct {
 	db *gorm.DB
 }
 
-func NewUserRepository(db *gorm.DB) *UserRepository {
-	return &UserRepository{db}
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &userRepository{db}
 }
 
-func (r *UserRepository) CreateUser(user *models.User) error {
+func (r *userRepository) CreateUser(user *models.User) error {
 	return r.db.Create(user).Error
 }
 
-func (r *UserRepository) GetUserByID(id int) (*models.User, error) {
+func (r *userRepository) GetUserByID(id int) (*models.User, error) {
 	var user models.User
 	err := r.db.First(&user, id).Error
 	if err != nil {
@@ -27,10 +35,56 @@ func (r *UserRepository) GetUserByID(id int) (*models.User, error) {
 	return &user, nil
 }
 
-func (r *UserRepository) UpdateUser(user *models.User, updates map[string]interface{}) error {
+func (r *userRepository) UpdateUser(user *models.User, updates map[string]interface{}) error {
 	return r.db.Model(user).Updates(updates).Error
 }
 
-func (r *UserRepository) DeleteUser(id int) error {
-	return r.db.Delete(&models.User{}, id).Error
+// DeleteUser deletes the user and everything they own in one transaction: their workouts with the exercises and sets
+// logged in them, records, templates, aliases and custom exercises. The soft deletes cascade here rather than in the
+// database, whose foreign keys only restrict; children go before their parents.
+func (r *userRepository) DeleteUser(id int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		workouts := tx.Model(&models.Workout{}).Select("id").Where("user_id = ?", id)
+		workoutExercises := tx.Model(&models.WorkoutExercise{}).Select("id").Where("workout_id IN (?)", workouts)
+		templates := tx.Model(&models.WorkoutTemplate{}).Select("id").Where("user_id = ?", id)
+		exercises := tx.Model(&models.Exercise{}).Select("id").Where("user_id = ?", id)
+
+		deletes := []struct {
+			model interface{}
+			query string
+			args  []interface{}
+		}{
+			{&models.PersonalRecord{}, "user_id = ?", []interface{}{id}},
+			{&models.Set{}, "workout_exercise_id IN (?)", []interface{}{workoutExercises}},
+			{&models.WorkoutExercise{}, "workout_id IN (?)", []interface{}{workouts}},
+			{&models.Workout{}, "user_id = ?", []interface{}{id}},
+			{&models.TemplateExercise{}, "template_id IN (?)", []interface{}{templates}},
+			{&models.WorkoutTemplate{}, "user_id = ?", []interface{}{id}},
+			{&models.ExerciseAlias{}, "user_id = ? OR exercise_id IN (?)", []interface{}{id, exercises}},
+			{&models.Exercise{}, "user_id = ?", []interface{}{id}},
+		}
+		for _, d := range deletes {
+			if err := tx.Where(d.query, d.args...).Delete(d.model).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Delete(&models.User{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (r *userRepository) GetUserByUsername(username string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("username = ?", username).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
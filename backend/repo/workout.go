@@ -1,64 +1,198 @@
 package repo
 
 import (
+	"fmt"
+	"time"
 	"workout/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type WorkoutRepository struct {
+// WorkoutFilter narrows a workout listing; zero values do not filter
+type WorkoutFilter struct {
+	From       *time.Time
+	To         *time.Time // exclusive
+	ExerciseID int        // only workouts containing this exercise
+	NamePrefix string
+}
+
+var workoutSortColumns = map[string]sortColumn{
+	"date": {"workouts.performed_at", sortTime},
+	"name": {"workouts.name", sortString},
+}
+
+type WorkoutRepository interface {
+	CreateWorkout(workout *models.Workout) error
+	CreateFullWorkout(workout *models.Workout) error
+	GetWorkoutByID(userID uint, id int) (*models.Workout, error)
+	UpdateWorkout(userID uint, workout *models.Workout, updates map[string]interface{}) error
+	DeleteWorkout(userID uint, id int) ([]uint, error)
+	ListWorkouts(userID uint, filter WorkoutFilter, page PageRequest) (*models.Page[models.Workout], error)
+	GetWorkoutDetails(userID uint, id int) (*models.WorkoutDetails, error)
+	GetWorkoutDetailsMany(userID uint, ids []uint) ([]models.WorkoutDetails, error)
+}
+
+type workoutRepository struct {
 	db *gorm.DB
 }
 
-func NewWorkoutRepository(db *gorm.DB) *WorkoutRepository {
-	return &WorkoutRepository{db}
+func NewWorkoutRepository(db *gorm.DB) WorkoutRepository {
+	return &workoutRepository{db}
+}
+
+// CreateWorkout creates the workout on its own, exercises given with it are left out
+func (r *workoutRepository) CreateWorkout(workout *models.Workout) error {
+	return r.db.Omit(clause.Associations).Create(workout).Error
 }
 
-func (r *WorkoutRepository) CreateWorkout(workout *models.Workout) error {
-	return r.db.Create(workout).Error
+// CreateFullWorkout creates the workout together with its exercises and their sets in one transaction
+func (r *workoutRepository) CreateFullWorkout(workout *models.Workout) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(workout).Error
+	})
 }
 
-func (r *WorkoutRepository) GetWorkoutByID(id int) (*models.Workout, error) {
+func (r *workoutRepository) GetWorkoutByID(userID uint, id int) (*models.Workout, error) {
 	var workout models.Workout
-	err := r.db.First(&workout, id).Error
+	err := r.db.Where("user_id = ?", userID).First(&workout, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &workout, nil
 }
 
-func (r *WorkoutRepository) UpdateWorkout(workout *models.Workout, updates map[string]interface{}) error {
-	return r.db.Model(workout).Updates(updates).Error
+func (r *workoutRepository) UpdateWorkout(userID uint, workout *models.Workout, updates map[string]interface{}) error {
+	return r.db.Model(workout).Where("user_id = ?", userID).Updates(updates).Error
 }
 
-func (r *WorkoutRepository) DeleteWorkout(id int) error {
-	return r.db.Delete(&models.Workout{}, id).Error
+// DeleteWorkout deletes the workout together with its exercises and their sets in one transaction. It returns the
+// exercises the workout logged, their records have to be recomputed.
+func (r *workoutRepository) DeleteWorkout(userID uint, id int) ([]uint, error) {
+	var exerciseIDs []uint
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ?", userID).Delete(&models.Workout{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		workoutExercises := tx.Model(&models.WorkoutExercise{}).Where("workout_id = ?", id)
+		err := workoutExercises.Session(&gorm.Session{}).Distinct().Pluck("exercise_id", &exerciseIDs).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("workout_exercise_id IN (?)", workoutExercises.Session(&gorm.Session{}).Select("id")).Delete(&models.Set{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("workout_id = ?", id).Delete(&models.WorkoutExercise{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exerciseIDs, nil
 }
 
-func (r *WorkoutRepository) GetWorkoutDetails(id int) (*models.WorkoutDetails, error) {
-	var workoutDetails models.WorkoutDetails
+func (r *workoutRepository) ListWorkouts(userID uint, filter WorkoutFilter, page PageRequest) (*models.Page[models.Workout], error) {
+	query := r.db.Model(&models.Workout{}).Where("workouts.user_id = ?", userID)
+	if filter.From != nil {
+		query = query.Where("workouts.performed_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("workouts.performed_at < ?", *filter.To)
+	}
+	if filter.ExerciseID != 0 {
+		query = query.Where("workouts.id IN (?)", r.db.Model(&models.WorkoutExercise{}).Select("workout_id").Where("exercise_id = ?", filter.ExerciseID))
+	}
+	if filter.NamePrefix != "" {
+		query = query.Where(`LOWER(workouts.name) LIKE ? ESCAPE '\'`, prefixPattern(filter.NamePrefix))
+	}
+
+	return paginate(query, "workouts", page, "-date", workoutSortColumns, func(w models.Workout, sort string) (interface{}, uint) {
+		if sort == "name" {
+			return w.Name, w.ID
+		}
+		return w.PerformedAt, w.ID
+	})
+}
 
-	var workout models.Workout
-	err := r.db.Preload("Exercises.Sets").Where("id = ?", id).First(&workout).Error
+// GetWorkoutDetails loads one of the user's workouts with its exercises and sets
+func (r *workoutRepository) GetWorkoutDetails(userID uint, id int) (*models.WorkoutDetails, error) {
+	details, err := r.GetWorkoutDetailsMany(userID, []uint{uint(id)})
 	if err != nil {
 		return nil, err
 	}
+	if len(details) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &details[0], nil
+}
 
-	workoutDetails.ID = workout.ID
-	workoutDetails.Name = workout.Name
+// GetWorkoutDetailsMany loads the details of the user's workouts among ids, in the order of ids, leaving out the ones
+// not found. It takes four queries however many workouts, exercises and sets there are: the workouts, their
+// exercises, their sets and the exercise names.
+func (r *workoutRepository) GetWorkoutDetailsMany(userID uint, ids []uint) ([]models.WorkoutDetails, error) {
+	if len(ids) == 0 {
+		return []models.WorkoutDetails{}, nil
+	}
 
-	for _, we := range workout.Exercises {
-		var exercise models.Exercise
-		r.db.First(&exercise, we.ExerciseID)
+	var workouts []models.Workout
+	err := r.db.
+		Preload("Exercises", func(db *gorm.DB) *gorm.DB { return db.Order("workout_exercises.position, workout_exercises.id") }).
+		Preload("Exercises.Sets", func(db *gorm.DB) *gorm.DB { return db.Order("sets.set_number, sets.id") }).
+		Where("id IN ? AND user_id = ?", ids, userID).
+		Find(&workouts).Error
+	if err != nil {
+		return nil, err
+	}
 
-		exerciseDetails := models.ExerciseDetails{
-			ID:   exercise.ID,
-			Name: exercise.Name,
-			Sets: we.Sets,
+	exerciseIDs := []uint{}
+	for _, workout := range workouts {
+		for _, we := range workout.Exercises {
+			exerciseIDs = append(exerciseIDs, we.ExerciseID)
+		}
+	}
+	exercises := map[uint]models.Exercise{}
+	if len(exerciseIDs) > 0 {
+		var found []models.Exercise
+		// deleted exercises keep their name in past workouts
+		if err := r.db.Unscoped().Where("id IN ?", exerciseIDs).Find(&found).Error; err != nil {
+			return nil, err
 		}
+		for _, exercise := range found {
+			exercises[exercise.ID] = exercise
+		}
+	}
 
-		workoutDetails.Exercises = append(workoutDetails.Exercises, exerciseDetails)
+	byID := map[uint]models.WorkoutDetails{}
+	for _, workout := range workouts {
+		details := models.WorkoutDetails{
+			ID:              workout.ID,
+			Name:            workout.Name,
+			PerformedAt:     workout.PerformedAt,
+			StartedAt:       workout.StartedAt,
+			FinishedAt:      workout.FinishedAt,
+			DurationSeconds: workout.DurationSeconds(),
+		}
+		for _, we := range workout.Exercises {
+			exercise, ok := exercises[we.ExerciseID]
+			if !ok {
+				return nil, fmt.Errorf("exercise %d of workout %d not found", we.ExerciseID, workout.ID)
+			}
+			details.Exercises = append(details.Exercises, models.NewExerciseDetails(exercise, we))
+		}
+		byID[workout.ID] = details
 	}
 
-	return &workoutDetails, nil
+	result := make([]models.WorkoutDetails, 0, len(byID))
+	for _, id := range ids {
+		if details, ok := byID[id]; ok {
+			result = append(result, details)
+			delete(byID, id)
+		}
+	}
+	return result, nil
 }
@@ -1,24 +1,305 @@
 package repo
 
 import (
+	"errors"
 	"workout/models"
 
 	"gorm.io/gorm"
 )
 
-type WorkoutExerciseRepository struct {
+var (
+	// ErrInvalidOrder is returned when a new order does not list every exercise of the workout exactly once
+	ErrInvalidOrder = errors.New("the order must list every exercise of the workout exactly once and keep groups together")
+	// ErrInvalidGroup is returned when a group would take an exercise twice, one of another workout or one already grouped
+	ErrInvalidGroup = errors.New("a group takes distinct exercises of the workout that are not grouped yet")
+)
+
+var workoutExerciseSortColumns = map[string]sortColumn{
+	"date":     {"workout_exercises.created_at", sortTime},
+	"position": {"workout_exercises.position", sortInt},
+}
+
+type WorkoutExerciseRepository interface {
+	AddExerciseToWorkout(userID uint, exercise *models.WorkoutExercise) error
+	GetWorkoutExerciseByID(userID uint, workoutID, id int) (*models.WorkoutExercise, error)
+	ListWorkoutExercises(userID uint, workoutID int, page PageRequest) (*models.Page[models.WorkoutExercise], error)
+	ReorderWorkoutExercises(userID uint, workoutID int, ids []uint) error
+	GroupWorkoutExercises(userID uint, workoutID int, groupType models.GroupType, ids []uint) (uint, error)
+	UngroupWorkoutExercises(userID uint, workoutID int, groupID uint) error
+	DeleteWorkoutExercise(userID uint, exercise *models.WorkoutExercise) error
+	SubstituteExercise(userID uint, exercise *models.WorkoutExercise, exerciseID uint) error
+}
+
+type workoutExerciseRepository struct {
 	db *gorm.DB
 }
 
-func NewWorkoutExerciseRepository(db *gorm.DB) *WorkoutExerciseRepository {
-	return &WorkoutExerciseRepository{db}
+func NewWorkoutExerciseRepository(db *gorm.DB) WorkoutExerciseRepository {
+	return &workoutExerciseRepository{db}
 }
 
-func (r *WorkoutExerciseRepository) GetWorkoutExerciseByID(id int) (*models.WorkoutExercise, error) {
+// AddExerciseToWorkout links an exercise to one of the user's workouts, after the exercises it already has
+func (r *workoutExerciseRepository) AddExerciseToWorkout(userID uint, exercise *models.WorkoutExercise) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkWorkoutOwner(tx, userID, int(exercise.WorkoutID)); err != nil {
+			return err
+		}
+
+		err := tx.Model(&models.WorkoutExercise{}).
+			Select("COALESCE(MAX(position), 0) + 1").
+			Where("workout_id = ?", exercise.WorkoutID).
+			Scan(&exercise.Position).Error
+		if err != nil {
+			return err
+		}
+		// sets are logged through the set routes, which validate them
+		return tx.Omit("Sets").Create(exercise).Error
+	})
+}
+
+// GetWorkoutExerciseByID only finds the workout exercise when it is part of the given workout and that workout belongs to the user
+func (r *workoutExerciseRepository) GetWorkoutExerciseByID(userID uint, workoutID, id int) (*models.WorkoutExercise, error) {
 	var exercise models.WorkoutExercise
-	err := r.db.First(&exercise, id).Error
+	err := r.db.Where("id IN (?)", ownedWorkoutExerciseIDs(r.db, userID)).
+		Where("workout_id = ?", workoutID).
+		First(&exercise, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &exercise, nil
 }
+
+func (r *workoutExerciseRepository) ListWorkoutExercises(userID uint, workoutID int, page PageRequest) (*models.Page[models.WorkoutExercise], error) {
+	query := r.db.Model(&models.WorkoutExercise{}).
+		Where("workout_exercises.id IN (?)", ownedWorkoutExerciseIDs(r.db, userID)).
+		Where("workout_exercises.workout_id = ?", workoutID)
+
+	return paginate(query, "workout_exercises", page, "position", workoutExerciseSortColumns, func(we models.WorkoutExercise, sort string) (interface{}, uint) {
+		if sort == "date" {
+			return we.CreatedAt, we.ID
+		}
+		return we.Position, we.ID
+	})
+}
+
+// ReorderWorkoutExercises numbers the exercises of the user's workout in the order of ids, which has to list each of
+// them exactly once and keep the exercises of a group together. The positions change together or not at all.
+func (r *workoutExerciseRepository) ReorderWorkoutExercises(userID uint, workoutID int, ids []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := workoutExercisesInOrder(tx, userID, workoutID)
+		if err != nil {
+			return err
+		}
+		if len(ids) != len(current) {
+			return ErrInvalidOrder
+		}
+		remaining := map[uint]models.WorkoutExercise{}
+		for _, exercise := range current {
+			remaining[exercise.ID] = exercise
+		}
+		ordered := make([]models.WorkoutExercise, 0, len(ids))
+		for _, id := range ids {
+			exercise, ok := remaining[id]
+			if !ok {
+				return ErrInvalidOrder
+			}
+			ordered = append(ordered, exercise)
+			delete(remaining, id)
+		}
+		if !groupsTogether(ordered) {
+			return ErrInvalidOrder
+		}
+
+		return setPositions(tx, ordered)
+	})
+}
+
+// GroupWorkoutExercises groups exercises of the user's workout, in the order of ids, and returns the ID of the new
+// group. The exercises have to be distinct and not grouped yet; they move to where the first of them was so the
+// group is performed in one go.
+func (r *workoutExerciseRepository) GroupWorkoutExercises(userID uint, workoutID int, groupType models.GroupType, ids []uint) (uint, error) {
+	var groupID uint
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := workoutExercisesInOrder(tx, userID, workoutID)
+		if err != nil {
+			return err
+		}
+
+		members := map[uint]models.WorkoutExercise{}
+		for _, exercise := range current {
+			if exercise.GroupID != nil && *exercise.GroupID >= groupID {
+				groupID = *exercise.GroupID
+			}
+			members[exercise.ID] = exercise
+		}
+		groupID++
+		grouped := make([]models.WorkoutExercise, 0, len(ids))
+		for _, id := range ids {
+			exercise, ok := members[id]
+			if !ok || exercise.GroupID != nil {
+				return ErrInvalidGroup
+			}
+			grouped = append(grouped, exercise)
+			delete(members, id)
+		}
+
+		ordered := make([]models.WorkoutExercise, 0, len(current))
+		placed := false
+		for _, exercise := range current {
+			if _, ok := members[exercise.ID]; ok {
+				ordered = append(ordered, exercise)
+			} else if !placed {
+				ordered = append(ordered, grouped...)
+				placed = true
+			}
+		}
+		if err := setPositions(tx, ordered); err != nil {
+			return err
+		}
+		return tx.Model(&models.WorkoutExercise{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{"group_id": groupID, "group_type": groupType}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return groupID, nil
+}
+
+// UngroupWorkoutExercises splits a group of the user's workout up, its exercises stay where they are
+func (r *workoutExerciseRepository) UngroupWorkoutExercises(userID uint, workoutID int, groupID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkWorkoutOwner(tx, userID, workoutID); err != nil {
+			return err
+		}
+		result := tx.Model(&models.WorkoutExercise{}).
+			Where("workout_id = ? AND group_id = ?", workoutID, groupID).
+			Updates(map[string]interface{}{"group_id": nil, "group_type": ""})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteWorkoutExercise removes the exercise and its sets from the user's workout and moves the later exercises up so
+// positions stay contiguous. A group left too small by the removal is split up.
+func (r *workoutExerciseRepository) DeleteWorkoutExercise(userID uint, exercise *models.WorkoutExercise) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkWorkoutOwner(tx, userID, int(exercise.WorkoutID)); err != nil {
+			return err
+		}
+		owned := ownedWorkoutExerciseIDs(tx, userID)
+		err := tx.Where("workout_exercise_id = ? AND workout_exercise_id IN (?)", exercise.ID, owned).Delete(&models.Set{}).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Where("id IN (?)", owned).Delete(exercise)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		err = tx.Model(&models.WorkoutExercise{}).
+			Where("workout_id = ? AND position > ?", exercise.WorkoutID, exercise.Position).
+			Update("position", gorm.Expr("position - 1")).Error
+		if err != nil || exercise.GroupID == nil {
+			return err
+		}
+
+		group := tx.Model(&models.WorkoutExercise{}).Where("workout_id = ? AND group_id = ?", exercise.WorkoutID, *exercise.GroupID)
+		var left int64
+		if err := group.Session(&gorm.Session{}).Count(&left).Error; err != nil {
+			return err
+		}
+		if exercise.GroupType.ValidateSize(int(left)) == "" {
+			return nil
+		}
+		return group.Updates(map[string]interface{}{"group_id": nil, "group_type": ""}).Error
+	})
+}
+
+// SubstituteExercise swaps the movement of the user's workout exercise, keeping its position and sets
+func (r *workoutExerciseRepository) SubstituteExercise(userID uint, exercise *models.WorkoutExercise, exerciseID uint) error {
+	result := r.db.Model(exercise).
+		Where("id IN (?)", ownedWorkoutExerciseIDs(r.db, userID)).
+		Update("exercise_id", exerciseID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// checkWorkoutOwner returns gorm.ErrRecordNotFound unless the workout belongs to the user
+func checkWorkoutOwner(db *gorm.DB, userID uint, workoutID int) error {
+	var count int64
+	err := db.Model(&models.Workout{}).Where("id = ? AND user_id = ?", workoutID, userID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// workoutExercisesInOrder loads the exercises of the user's workout by position
+func workoutExercisesInOrder(db *gorm.DB, userID uint, workoutID int) ([]models.WorkoutExercise, error) {
+	if err := checkWorkoutOwner(db, userID, workoutID); err != nil {
+		return nil, err
+	}
+	var exercises []models.WorkoutExercise
+	err := db.Where("workout_id = ?", workoutID).Order("position, id").Find(&exercises).Error
+	if err != nil {
+		return nil, err
+	}
+	return exercises, nil
+}
+
+// setPositions numbers the workout exercises in the order given
+func setPositions(db *gorm.DB, ordered []models.WorkoutExercise) error {
+	for i, exercise := range ordered {
+		if exercise.Position == i+1 {
+			continue
+		}
+		err := db.Model(&models.WorkoutExercise{}).Where("id = ?", exercise.ID).Update("position", i+1).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupsTogether reports whether the exercises of every group come one after another
+func groupsTogether(ordered []models.WorkoutExercise) bool {
+	done := map[uint]bool{}
+	for i, exercise := range ordered {
+		if exercise.GroupID == nil {
+			continue
+		}
+		id := *exercise.GroupID
+		if i > 0 && ordered[i-1].GroupID != nil && *ordered[i-1].GroupID == id {
+			continue
+		}
+		if done[id] {
+			return false
+		}
+		done[id] = true
+	}
+	return true
+}
+
+// ownedWorkoutExerciseIDs selects the IDs of the workout exercises in workouts belonging to the user
+func ownedWorkoutExerciseIDs(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Model(&models.WorkoutExercise{}).
+		Select("workout_exercises.id").
+		Joins("JOIN workouts ON workouts.id = workout_exercises.workout_id").
+		Where("workouts.user_id = ? AND workouts.deleted_at IS NULL", userID)
+}
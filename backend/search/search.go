@@ -0,0 +1,155 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// relevance of the ways a query can match a name, higher is better
+const (
+	ExactMatch     = 1.0
+	PrefixMatch    = 0.9
+	WordsMatch     = 0.8 // every query word starts a word of the name
+	SubstringMatch = 0.7
+	FuzzyMatch     = 0.6 // every query word is within a few typos of a word of the name, less per typo
+	typoPenalty    = 0.05
+
+	// AliasPenalty lowers matches on an alias or an expanded abbreviation below equal matches on the name itself
+	AliasPenalty = 0.95
+)
+
+// common gym abbreviations, expanded word by word so "db row" finds "Dumbbell Row"
+var abbreviations = map[string]string{
+	"ohp":  "overhead press",
+	"bp":   "bench press",
+	"dl":   "deadlift",
+	"rdl":  "romanian deadlift",
+	"sldl": "stiff leg deadlift",
+	"db":   "dumbbell",
+	"bb":   "barbell",
+	"kb":   "kettlebell",
+	"ez":   "ez bar",
+	"ghr":  "glute ham raise",
+	"hspu": "handstand push up",
+	"bss":  "bulgarian split squat",
+	"pu":   "pull up",
+	"cg":   "close grip",
+}
+
+// Normalize lowercases s and reduces it to words of letters and digits separated by single spaces, so "Pull-Up"
+// and "pull up" compare equal
+func Normalize(s string) string {
+	return strings.Join(words(s), " ")
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Expand replaces the abbreviations in the query. It returns the normalized query unchanged when it has none.
+func Expand(query string) string {
+	parts := words(query)
+	for i, part := range parts {
+		if expanded, ok := abbreviations[part]; ok {
+			parts[i] = expanded
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Score rates how well the query matches the name, 0 when it does not match at all. Both are normalized first.
+func Score(query, name string) float64 {
+	query, name = Normalize(query), Normalize(name)
+	if query == "" || name == "" {
+		return 0
+	}
+	switch {
+	case query == name:
+		return ExactMatch
+	case strings.HasPrefix(name, query):
+		return PrefixMatch
+	}
+
+	queryWords, nameWords := words(query), words(name)
+	if allWords(queryWords, nameWords, func(q, n string) bool { return strings.HasPrefix(n, q) }) {
+		return WordsMatch
+	}
+	if strings.Contains(name, query) {
+		return SubstringMatch
+	}
+
+	typos := 0
+	for _, q := range queryWords {
+		best := -1
+		for _, n := range nameWords {
+			// a word still being typed is compared with the start of the name word
+			if len(n) > len(q) {
+				n = n[:len(q)]
+			}
+			if d := distance(q, n); d <= tolerance(q) && (best < 0 || d < best) {
+				best = d
+			}
+		}
+		if best < 0 {
+			return 0
+		}
+		typos += best
+	}
+	return FuzzyMatch - typoPenalty*float64(typos)
+}
+
+func allWords(queryWords, nameWords []string, match func(q, n string) bool) bool {
+	for _, q := range queryWords {
+		found := false
+		for _, n := range nameWords {
+			if match(q, n) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// tolerance is how many typos a word of the query may have, none for short words where one typo makes another word
+func tolerance(word string) int {
+	switch n := len([]rune(word)); {
+	case n <= 3:
+		return 0
+	case n <= 7:
+		return 1
+	}
+	return 2
+}
+
+// distance is the optimal string alignment distance of a and b: insertions, deletions, substitutions and swaps of
+// two neighbouring letters each count as one edit
+func distance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}